@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// arxivApiUrl is the arXiv API endpoint papers are searched on by title.
+var arxivApiUrl = "http://export.arxiv.org/api/query"
+
+// arxivSource marks index entries downloaded from arXiv.
+const arxivSource = "arxiv"
+
+// maxArxivResults is how many search results are compared against the title.
+const maxArxivResults = 5
+
+// arxivFeed is the part of the Atom feed returned by the arXiv API we use.
+type arxivFeed struct {
+	Entries []struct {
+		Title string `xml:"title"`
+		Links []struct {
+			Href  string `xml:"href,attr"`
+			Title string `xml:"title,attr"`
+			Type  string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func isArxivUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (u.Host == "arxiv.org" || strings.HasSuffix(u.Host, ".arxiv.org"))
+}
+
+// searchArxiv returns the PDF URL of the arXiv paper with the given title. Only
+// exact matches, ignoring case and punctuation, are trusted; anything else
+// yields NoArxivMatchErr.
+func searchArxiv(ctx context.Context, title string) (string, error) {
+	query := url.Values{}
+	// arXiv phrase searches choke on punctuation, so search the title's words
+	query.Set("search_query", fmt.Sprintf(`ti:"%s"`, strings.Replace(slugify(title), "-", " ", -1)))
+	query.Set("max_results", fmt.Sprint(maxArxivResults))
+	searchUrl := arxivApiUrl + "?" + query.Encode()
+
+	resp, err := httpGet(ctx, searchUrl)
+	if err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &URLError{PageUrl: searchUrl, Err: fmt.Errorf("unexpected status %s", resp.Status)}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	var feed arxivFeed
+	if err := xml.NewDecoder(body).Decode(&feed); err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	for _, entry := range feed.Entries {
+		if slugify(entry.Title) != slugify(title) {
+			continue
+		}
+		for _, link := range entry.Links {
+			if link.Title == "pdf" || link.Type == "application/pdf" {
+				// the API still hands out plain HTTP links
+				return strings.Replace(link.Href, "http://", "https://", 1), nil
+			}
+		}
+	}
+	return "", &URLError{PageUrl: searchUrl, Err: NoArxivMatchErr}
+}
+
+// downloadFromArxiv downloads paper from arXiv instead, if -arxiv-fallback is
+// set and arXiv has a paper with the same title, recording it in b. It reports
+// whether the paper was downloaded.
+func (r *conferenceRun) downloadFromArxiv(ctx context.Context, paper Paper, b *batch) bool {
+	if !config.arxivFallback || paper.Title == "" || isArxivUrl(paper.DownloadURL) || ctx.Err() != nil {
+		return false
+	}
+	pdfUrl, err := searchArxiv(ctx, paper.Title)
+	if err != nil {
+		logger.warnf("no arXiv fallback for %q: %s", paper.Title, err)
+		return false
+	}
+	logger.infof("falling back to arXiv for %q: %s", paper.Title, pdfUrl)
+	paper.DownloadURL = pdfUrl
+	return r.downloadPaperFrom(ctx, paper, arxivSource, b)
+}
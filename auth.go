@@ -0,0 +1,33 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+// authHostMatches reports whether host is one of the -auth-host hosts or a
+// subdomain of one.
+func authHostMatches(host string) bool {
+	host = strings.ToLower(strings.Split(host, ":")[0])
+	for _, authHost := range config.authHosts {
+		authHost = strings.ToLower(authHost)
+		if host == authHost || strings.HasSuffix(host, "."+authHost) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize adds the -auth-user/-auth-pass or -auth-header credentials to req
+// if it goes to one of the -auth-host hosts, and only then, so they don't leak
+// to Scholar or any other site.
+func authorize(req *http.Request) {
+	if !authHostMatches(req.URL.Host) {
+		return
+	}
+	if config.authHeader != "" {
+		req.Header.Set("Authorization", config.authHeader)
+	} else if config.authUser != "" {
+		req.SetBasicAuth(config.authUser, config.authPass)
+	}
+}
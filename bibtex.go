@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// words skipped when picking the title word of a cite key
+var citeKeyStopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "on": true, "of": true, "and": true,
+	"for": true, "in": true, "to": true, "with": true, "towards": true,
+}
+
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	"&", `\&`,
+	"%", `\%`,
+	"$", `\$`,
+	"#", `\#`,
+	"_", `\_`,
+	"{", `\{`,
+	"}", `\}`,
+)
+
+// citeKeyFolder spells common accented letters without their accents.
+var citeKeyFolder = strings.NewReplacer(
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "æ", "ae",
+	"ç", "c", "è", "e", "é", "e", "ê", "e", "ë", "e",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ñ", "n",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "œ", "oe",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ý", "y", "ÿ", "y", "ß", "ss",
+	"č", "c", "ć", "c", "š", "s", "ś", "s", "ž", "z", "ź", "z", "ł", "l", "ř", "r", "ğ", "g", "ı", "i",
+)
+
+// citeKeyPart lowercases s and keeps only the ASCII letters, digits and
+// hyphens, which any BibTeX tool accepts in cite keys.
+func citeKeyPart(s string) string {
+	return strings.Map(func(c rune) rune {
+		if c > unicode.MaxASCII || !(unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-') {
+			return -1
+		}
+		return c
+	}, citeKeyFolder.Replace(strings.ToLower(s)))
+}
+
+// firstAuthorSurname returns the last name of the first of the authors as
+// given by the parsers, or "" if they are unknown.
+func firstAuthorSurname(authors string) string {
+	first := authors
+	for _, separator := range []string{",", ";", " and "} {
+		first = strings.SplitN(first, separator, 2)[0]
+	}
+	names := strings.Fields(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(first), "…")))
+	if len(names) == 0 {
+		return ""
+	}
+	return citeKeyPart(names[len(names)-1])
+}
+
+// citeKey derives the cite key of a paper, <author><year><titleword> from the
+// first author's surname and the first significant word of the title. Papers
+// whose authors are unknown get their longCiteKey.
+func citeKey(conf Conference, entry IndexEntry) string {
+	surname := firstAuthorSurname(entry.Authors)
+	if surname == "" {
+		return longCiteKey(conf, entry)
+	}
+	words := strings.FieldsFunc(strings.ToLower(entry.Title), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+	for _, word := range words {
+		if word := citeKeyPart(word); word != "" && !citeKeyStopWords[word] {
+			return fmt.Sprintf("%s%d%s", surname, conf.Year, word)
+		}
+	}
+	return longCiteKey(conf, entry)
+}
+
+// longCiteKey is the cite key <author><year>_<title slug>, with the conference
+// name standing in for unknown authors, for papers without a citeKey of their
+// own. Papers without a title use their file name instead.
+func longCiteKey(conf Conference, entry IndexEntry) string {
+	prefix := firstAuthorSurname(entry.Authors)
+	if prefix == "" {
+		prefix = citeKeyPart(conf.Name)
+	}
+	title := entry.Title
+	if title == "" {
+		title = strings.TrimSuffix(entry.Filename, path.Ext(entry.Filename))
+	}
+	return fmt.Sprintf("%s%d_%s", prefix, conf.Year, citeKeyPart(slugify(title)))
+}
+
+// countCiteKeys counts the cite keys of the papers of runs in keys.
+func countCiteKeys(keys map[string]int, runs ...*conferenceRun) {
+	for _, run := range runs {
+		for _, entry := range run.index {
+			keys[citeKey(run.conf, entry)]++
+		}
+	}
+}
+
+// writeBibtex writes an @inproceedings entry for every paper in the conference
+// index to references.bib in the conference directory.
+func (r *conferenceRun) writeBibtex() error {
+	var bib strings.Builder
+	keys := make(map[string]int)
+	countCiteKeys(keys, r)
+	r.appendBibtex(&bib, keys, make(map[string]bool))
+	return ioutil.WriteFile(r.filePath("references.bib"), []byte(bib.String()), 0644)
+}
+
+// appendBibtex appends an @inproceedings entry for every paper in the
+// conference index to bib. Papers whose cite key is counted more than once in
+// keys get their longCiteKey instead, so keys don't depend on the order papers
+// are listed in. Keys already used are numbered.
+func (r *conferenceRun) appendBibtex(bib *strings.Builder, keys map[string]int, used map[string]bool) {
+	for _, entry := range r.index {
+		key := citeKey(r.conf, entry)
+		if keys[key] > 1 {
+			key = longCiteKey(r.conf, entry)
+		}
+		// only the same title twice gets here
+		for n, base := 2, key; used[key]; n++ {
+			key = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[key] = true
+
+		fmt.Fprintf(bib, "@inproceedings{%s,\n", key)
+		if entry.Title != "" {
+			fmt.Fprintf(bib, "  title = {{%s}},\n", bibtexEscaper.Replace(entry.Title))
+		}
+		if authors := bibtexAuthors(entry.Authors); authors != "" {
+			fmt.Fprintf(bib, "  author = {%s},\n", bibtexEscaper.Replace(authors))
+		}
+		fmt.Fprintf(bib, "  booktitle = {%s},\n", bibtexEscaper.Replace(r.conf.Name))
+		fmt.Fprintf(bib, "  year = {%d},\n", r.conf.Year)
+		fmt.Fprintf(bib, "  url = {%s},\n", entry.DownloadUrl)
+		fmt.Fprintf(bib, "  file = {%s},\n", r.paperPath(entry.Filename))
+		bib.WriteString("}\n\n")
+	}
+}
+
+// bibtexAuthors turns a comma-separated author list as given by the parsers
+// into BibTeX's "A and B" form. Lists Scholar cut short with an ellipsis end in
+// "and others".
+func bibtexAuthors(authors string) string {
+	names := make([]string, 0)
+	truncated := false
+	for _, name := range strings.Split(authors, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasSuffix(name, "…") {
+			truncated = true
+			name = strings.TrimSpace(strings.TrimSuffix(name, "…"))
+		}
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	if truncated && len(names) > 0 {
+		names = append(names, "others")
+	}
+	return strings.Join(names, " and ")
+}
+
+// writeBibtexFile writes the BibTeX entries of the papers of all conferences
+// to references.bib in the output directory. The entries previous runs wrote
+// for conferences not among runs are kept.
+func writeBibtexFile(outputDirectory string, runs []*conferenceRun) error {
+	filepath := path.Join(outputDirectory, "references.bib")
+	previous, err := ioutil.ReadFile(filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	processed := make(map[string]bool)
+	for _, run := range runs {
+		processed[fmt.Sprintf("%s %d", bibtexEscaper.Replace(run.conf.Name), run.conf.Year)] = true
+	}
+
+	var bib strings.Builder
+	keys := make(map[string]int)
+	used := make(map[string]bool)
+	for _, entry := range strings.SplitAfter(string(previous), "\n}\n") {
+		match := bibtexEntryPattern.FindStringSubmatch(entry)
+		if match == nil || processed[match[2]+" "+match[3]] {
+			continue
+		}
+		keys[match[1]]++
+		used[match[1]] = true
+		bib.WriteString(strings.TrimLeft(entry, "\n"))
+		bib.WriteString("\n")
+	}
+	countCiteKeys(keys, runs...)
+	for _, run := range runs {
+		run.appendBibtex(&bib, keys, used)
+	}
+	return ioutil.WriteFile(filepath, []byte(bib.String()), 0644)
+}
+
+// bibtexEntryPattern matches an entry written by appendBibtex, capturing its
+// cite key and its escaped booktitle and year.
+var bibtexEntryPattern = regexp.MustCompile(`(?s)@inproceedings\{([^,]+),\n(?:.*?\n)?  booktitle = \{(.*?)\},\n  year = \{(\d+)\},`)
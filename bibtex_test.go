@@ -0,0 +1,57 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCiteKey(t *testing.T) {
+	conf := Conference{Name: "S&P", Year: 2019}
+	tests := []struct {
+		name  string
+		entry IndexEntry
+		want  string
+	}{
+		{"scholar authors", IndexEntry{Title: "The Spectre of Speculation", Authors: "P Kocher, J Horn, A Fogh…"}, "kocher2019spectre"},
+		{"usenix authors", IndexEntry{Title: "Fast Things", Authors: "Alice Smith and Bob Jones, Example University"}, "smith2019fast"},
+		{"accented surname", IndexEntry{Title: "Über Things", Authors: "Jane Müller"}, "muller2019uber"},
+		{"no authors", IndexEntry{Title: "Safe Things: A Study"}, "sp2019_safe-things-a-study"},
+		{"no title", IndexEntry{Filename: "sec19-paper.pdf"}, "sp2019_sec19-paper"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := citeKey(conf, test.entry); got != test.want {
+				t.Errorf("citeKey(%+v) = %q, want %q", test.entry, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBibtexKeysDontDependOnOrder(t *testing.T) {
+	first := IndexEntry{Title: "Fast Things", Authors: "Alice Smith", Filename: "a.pdf"}
+	second := IndexEntry{Title: "Fast Other Things", Authors: "Alice Smith", Filename: "b.pdf"}
+	keysOf := func(index ...IndexEntry) map[string]string {
+		run := &conferenceRun{conf: Conference{Name: "USENIX", Year: 2020}, index: index}
+		keys := make(map[string]int)
+		countCiteKeys(keys, run)
+		var bib strings.Builder
+		run.appendBibtex(&bib, keys, make(map[string]bool))
+		titles := make(map[string]string)
+		for _, match := range regexp.MustCompile(`@inproceedings\{([^,]+),\n  title = \{\{(.*?)\}\}`).FindAllStringSubmatch(bib.String(), -1) {
+			titles[match[2]] = match[1]
+		}
+		return titles
+	}
+
+	forward, backward := keysOf(first, second), keysOf(second, first)
+	want := map[string]string{
+		"Fast Things":       "smith2020_fast-things",
+		"Fast Other Things": "smith2020_fast-other-things",
+	}
+	for title, key := range want {
+		if forward[title] != key || backward[title] != key {
+			t.Errorf("%q got keys %q and %q depending on order, want %q", title, forward[title], backward[title], key)
+		}
+	}
+}
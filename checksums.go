@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const checksumsFilename = "checksums.txt"
+
+// readChecksums reads the SHA-256 checksums of a conference recorded in
+// filepath, keyed by file name. A missing checksums file yields no checksums.
+func readChecksums(filepath string) (map[string]string, error) {
+	checksums := make(map[string]string)
+	f, err := os.Open(filepath)
+	if os.IsNotExist(err) {
+		return checksums, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// same format as sha256sum: "<hash>  <file name>"
+		fields := strings.SplitN(scanner.Text(), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		checksums[fields[1]] = fields[0]
+	}
+	return checksums, scanner.Err()
+}
+
+// writeChecksums writes the conference checksums in the format used by
+// sha256sum, so they can also be checked with `sha256sum -c`.
+func (r *conferenceRun) writeChecksums() error {
+	filenames := make([]string, 0, len(r.checksums))
+	for filename := range r.checksums {
+		filenames = append(filenames, filename)
+	}
+	sort.Strings(filenames)
+
+	var checksums strings.Builder
+	for _, filename := range filenames {
+		fmt.Fprintf(&checksums, "%s  %s\n", r.checksums[filename], filename)
+	}
+	return ioutil.WriteFile(r.filePath(checksumsFilename), []byte(checksums.String()), 0644)
+}
+
+// pdfTrailerWindow is how far from the end of a PDF the %%EOF marker is looked
+// for, as writers may append whitespace or garbage after it.
+const pdfTrailerWindow = 1024
+
+// checkPdf reports whether the file looks like a complete PDF: not empty,
+// starting with the %PDF- header and with a %%EOF marker near its end.
+func checkPdf(filepath string) error {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return errors.New("empty file")
+	}
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(f, header); err != nil || string(header) != "%PDF-" {
+		return errors.New("missing %PDF- header")
+	}
+
+	offset := info.Size() - pdfTrailerWindow
+	if offset < 0 {
+		offset = 0
+	}
+	trailer := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(trailer, offset); err != nil && err != io.EOF {
+		return err
+	}
+	if !bytes.Contains(trailer, []byte("%%EOF")) {
+		return errors.New("missing %%EOF marker, probably truncated")
+	}
+	return nil
+}
+
+// verifyConference checks the papers of a conference against their recorded
+// checksums, and PDFs without a checksum for being complete, and returns the
+// number of missing or corrupt papers. With -repair or -overwrite they are
+// downloaded again from the URLs in the conference index.
+func verifyConference(ctx context.Context, conf Conference) (int, error) {
+	run, err := newConferenceRun(conf)
+	if err != nil {
+		return 0, err
+	}
+
+	filenames := make([]string, 0, len(run.checksums))
+	for filename := range run.checksums {
+		filenames = append(filenames, filename)
+	}
+	files, err := ioutil.ReadDir(run.directory)
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		if config.flat && !strings.HasPrefix(file.Name(), flatPrefix(run.conf)) {
+			continue
+		}
+		if _, ok := run.checksums[file.Name()]; !ok && strings.EqualFold(path.Ext(file.Name()), ".pdf") {
+			filenames = append(filenames, file.Name())
+		}
+	}
+	if len(filenames) == 0 {
+		logger.warnf("no papers to verify for %s", conf.String())
+		return 0, nil
+	}
+	sort.Strings(filenames)
+
+	bad := make([]string, 0)
+	for _, filename := range filenames {
+		filepath := run.paperPath(filename)
+		expected, recorded := run.checksums[filename]
+		sum, err := sha256File(filepath)
+		if os.IsNotExist(err) {
+			logger.warnf("missing: %s", filepath)
+		} else if err != nil {
+			return len(bad), err
+		} else if recorded && sum != expected {
+			logger.warnf("checksum mismatch: %s", filepath)
+		} else if err := checkPdf(filepath); err != nil {
+			logger.warnf("corrupt: %s: %s", filepath, err)
+		} else {
+			logger.debugf("ok: %s", filepath)
+			continue
+		}
+		bad = append(bad, filename)
+	}
+	logger.infof("%s: %d of %d papers failed verification", conf.String(), len(bad), len(filenames))
+
+	if !(config.repair || config.overwrite) || len(bad) == 0 {
+		return len(bad), nil
+	}
+
+	index, err := readIndex(run.filePath(indexFilename))
+	if err != nil {
+		return len(bad), err
+	}
+	urls := make(map[string]string)
+	for _, entry := range index {
+		urls[entry.Filename] = entry.DownloadUrl
+	}
+
+	repaired := 0
+	for _, filename := range bad {
+		url, ok := urls[filename]
+		if !ok {
+			logger.warnf("can't repair %s, no download URL in index", filename)
+			continue
+		}
+		filepath := run.paperPath(filename)
+		if err := os.Remove(filepath); err != nil && !os.IsNotExist(err) {
+			return len(bad) - repaired, err
+		}
+		if _, err := downloadFile(ctx, url, filepath, nil); err != nil {
+			logger.errorf("failed to download %s: %s", url, err)
+			continue
+		}
+		sum, err := sha256File(filepath)
+		if err != nil {
+			return len(bad) - repaired, err
+		}
+		run.checksums[filename] = sum
+		repaired++
+	}
+	return len(bad) - repaired, run.writeChecksums()
+}
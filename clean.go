@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runClean implements the clean subcommand, which finds PDFs in the output
+// directory that fail checkPdf, such as error pages saved as papers or
+// downloads cut short by a crash, and removes them with -force so the next run
+// fetches them again. It returns the exit status.
+func runClean(args []string) int {
+	flags := flag.NewFlagSet("clean", flag.ContinueOnError)
+	var outputDirectory string
+	var force bool
+	flags.StringVar(&outputDirectory, "output-dir", "papers", "output directory to clean")
+	flags.BoolVar(&force, "force", false, "remove the bad files instead of only listing them")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s clean [-output-dir DIR] [-force]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+
+	bad := 0
+	err := filepath.Walk(outputDirectory, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// .part files are kept on purpose, to resume from
+		if info.IsDir() || !strings.EqualFold(filepath.Ext(file), ".pdf") {
+			return nil
+		}
+		problem := checkPdf(file)
+		if problem == nil {
+			return nil
+		}
+		bad++
+		if !force {
+			fmt.Printf("would remove %s: %s\n", file, problem)
+			return nil
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+		fmt.Printf("removed %s: %s\n", file, problem)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "clean: %s\n", err)
+		return 1
+	}
+	if bad > 0 && !force {
+		fmt.Printf("%d bad files found, run again with -force to remove them\n", bad)
+	}
+	return 0
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const minConferenceYear = 1990
+
+// loadConferences reads and validates the list of conferences in filename,
+// which is parsed as YAML if it has a .yaml or .yml extension and as JSON
+// otherwise. A filename of "-" reads the list from stdin and an http or https
+// URL fetches it; both are parsed as JSON unless they look like YAML.
+func loadConferences(filename string) ([]Conference, error) {
+	bytes, err := readConferences(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var conferences []Conference
+	// the keys given for each entry, to catch misspelled fields
+	var keys [][]string
+	// describes where each entry is, for reporting problems
+	locate := func(i int) string {
+		return fmt.Sprintf("entry %d", i)
+	}
+	format := strings.ToLower(path.Ext(filename))
+	if u, err := url.Parse(filename); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		format = strings.ToLower(path.Ext(u.Path))
+	}
+	if (filename == "-" || format != ".json") && looksLikeYaml(bytes) {
+		format = ".yaml"
+	}
+	switch format {
+	case ".yaml", ".yml":
+		var lines []int
+		if conferences, keys, lines, err = parseYamlConferences(bytes); err != nil {
+			return nil, fmt.Errorf("parsing %s: %s", filename, err)
+		}
+		locate = func(i int) string {
+			return fmt.Sprintf("entry %d (line %d)", i, lines[i])
+		}
+	default:
+		if err := json.Unmarshal(bytes, &conferences); err != nil {
+			return nil, fmt.Errorf("parsing %s: %s", filename, locateJsonError(bytes, err))
+		}
+		var entries []map[string]json.RawMessage
+		if err := json.Unmarshal(bytes, &entries); err != nil {
+			return nil, fmt.Errorf("parsing %s: %s", filename, locateJsonError(bytes, err))
+		}
+		for _, entry := range entries {
+			entryKeys := make([]string, 0, len(entry))
+			for key := range entry {
+				entryKeys = append(entryKeys, key)
+			}
+			sort.Strings(entryKeys)
+			keys = append(keys, entryKeys)
+		}
+	}
+
+	if problems := validateConferences(conferences, keys, locate); len(problems) > 0 {
+		return nil, fmt.Errorf("invalid conferences in %s:\n  %s", filename, strings.Join(problems, "\n  "))
+	}
+	return conferences, nil
+}
+
+// readConferences reads the conference list from a file, stdin or a URL.
+func readConferences(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	u, err := url.Parse(filename)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ioutil.ReadFile(filename)
+	}
+
+	// a conference list isn't scraped, so robots.txt and the throttle don't apply
+	req, err := newRequest(context.Background(), filename)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fetcher.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &URLError{PageUrl: filename, Err: &UnexpectedStatusError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+	body, err := decodeBody(resp)
+	if err != nil {
+		return nil, &URLError{PageUrl: filename, Err: err}
+	}
+	return ioutil.ReadAll(body)
+}
+
+// looksLikeYaml reports whether a conference list without a telling file name
+// is YAML rather than JSON, which starts with a bracket.
+func looksLikeYaml(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '{'
+}
+
+// parseYamlConferences parses a YAML list of conferences, also returning the
+// keys given for each entry and the line each entry starts on.
+func parseYamlConferences(bytes []byte) ([]Conference, [][]string, []int, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(bytes, &document); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil, nil, nil
+	}
+
+	list := document.Content[0]
+	if list.Kind != yaml.SequenceNode {
+		return nil, nil, nil, fmt.Errorf("line %d: expected a list of conferences", list.Line)
+	}
+	conferences := make([]Conference, 0, len(list.Content))
+	keys := make([][]string, 0, len(list.Content))
+	lines := make([]int, 0, len(list.Content))
+	for _, item := range list.Content {
+		var conf Conference
+		if err := item.Decode(&conf); err != nil {
+			return nil, nil, nil, fmt.Errorf("line %d: %s", item.Line, err)
+		}
+		entryKeys := make([]string, 0)
+		if item.Kind == yaml.MappingNode {
+			// mapping nodes alternate keys and values
+			for i := 0; i < len(item.Content); i += 2 {
+				entryKeys = append(entryKeys, item.Content[i].Value)
+			}
+		}
+		conferences = append(conferences, conf)
+		keys = append(keys, entryKeys)
+		lines = append(lines, item.Line)
+	}
+	return conferences, keys, lines, nil
+}
+
+// locateJsonError adds the line and column to JSON errors that know the
+// offset they occurred at.
+func locateJsonError(data []byte, err error) error {
+	var offset int64
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		offset = e.Offset
+	case *json.UnmarshalTypeError:
+		offset = e.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return fmt.Errorf("line %d, column %d: %s", line, column, err)
+}
+
+// validateConferences returns a description of every problem found in the
+// conference list, so they can all be fixed at once. Keys that don't belong to
+// a Conference field are most likely misspellings and reported too.
+func validateConferences(conferences []Conference, keys [][]string, locate func(int) string) []string {
+	known := make(map[string]bool)
+	conferenceType := reflect.TypeOf(Conference{})
+	for i := 0; i < conferenceType.NumField(); i++ {
+		name := strings.Split(conferenceType.Field(i).Tag.Get("json"), ",")[0]
+		known[name] = true
+	}
+
+	problems := make([]string, 0)
+	maxYear := time.Now().Year() + 1
+	for i, conf := range conferences {
+		if i < len(keys) {
+			for _, key := range keys[i] {
+				if !known[key] {
+					problems = append(problems, fmt.Sprintf("%s: unknown field %q", locate(i), key))
+				}
+			}
+		}
+		if conf.Name == "" {
+			problems = append(problems, fmt.Sprintf("%s: missing name", locate(i)))
+		}
+		if conf.URL == "" {
+			problems = append(problems, fmt.Sprintf("%s (%s): missing url", locate(i), conf.String()))
+		} else if u, err := url.Parse(conf.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			problems = append(problems, fmt.Sprintf("%s (%s): invalid url %q", locate(i), conf.String(), conf.URL))
+		}
+		if conf.Year < minConferenceYear || conf.Year > maxYear {
+			problems = append(problems, fmt.Sprintf("%s (%s): year %d is not between %d and %d", locate(i), conf.String(), conf.Year, minConferenceYear, maxYear))
+		}
+		if conf.Matcher != nil {
+			for _, problem := range conf.Matcher.validate() {
+				problems = append(problems, fmt.Sprintf("%s (%s): %s", locate(i), conf.String(), problem))
+			}
+		}
+		if conf.NextPage != nil {
+			if conf.Matcher == nil {
+				problems = append(problems, fmt.Sprintf("%s (%s): nextPage needs a matcher", locate(i), conf.String()))
+			}
+			for _, problem := range conf.NextPage.validate() {
+				problems = append(problems, fmt.Sprintf("%s (%s): nextPage %s", locate(i), conf.String(), problem))
+			}
+		}
+	}
+	return problems
+}
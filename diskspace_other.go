@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// freeSpace is not supported outside of Unix, so -min-free-space does nothing.
+func freeSpace(directory string) (int64, error) {
+	return 0, errors.New("free space check not supported on this platform")
+}
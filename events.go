@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Names of the events written with -json-events.
+const (
+	conferenceStartedEvent = "conference_started"
+	paperResolvedEvent     = "paper_resolved"
+	downloadStartedEvent   = "download_started"
+	downloadCompletedEvent = "download_completed"
+	downloadSkippedEvent   = "download_skipped"
+	downloadFailedEvent    = "download_failed"
+)
+
+// Event is a line of the -json-events stream. Fields that don't apply to an
+// event are left out.
+type Event struct {
+	Time        time.Time `json:"time"`
+	Event       string    `json:"event"`
+	Conference  string    `json:"conference"`
+	Title       string    `json:"title,omitempty"`
+	PageUrl     string    `json:"pageUrl,omitempty"`
+	DownloadUrl string    `json:"downloadUrl,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Bytes       int64     `json:"bytes,omitempty"`
+	Seconds     float64   `json:"seconds,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+var eventsMu sync.Mutex
+
+// emitEvent writes event to stderr as a line of JSON if -json-events is set.
+func emitEvent(event Event) {
+	if !config.jsonEvents {
+		return
+	}
+	event.Time = time.Now()
+	line, err := json.Marshal(event)
+	if err != nil {
+		logger.errorf("%s", err)
+		return
+	}
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+	os.Stderr.Write(append(line, '\n'))
+}
+
+// paperEvent returns an event about the paper described by entry.
+func (r *conferenceRun) paperEvent(name string, entry IndexEntry) Event {
+	return Event{
+		Event:       name,
+		Conference:  r.conf.String(),
+		Title:       entry.Title,
+		PageUrl:     entry.SourcePageUrl,
+		DownloadUrl: entry.DownloadUrl,
+	}
+}
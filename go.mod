@@ -0,0 +1,9 @@
+module github.com/zzma/sec-fetch
+
+go 1.26.0
+
+require (
+	github.com/yhat/scrape v0.0.0-20161128144610-24b7890b0945
+	golang.org/x/net v0.59.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type conferenceKey struct{}
+
+// withConference returns a context whose requests carry the headers and
+// cookies configured for conf.
+func withConference(ctx context.Context, conf Conference) context.Context {
+	if len(conf.Headers) == 0 && len(conf.Cookies) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, conferenceKey{}, conf)
+}
+
+// addConferenceHeaders adds the headers and cookies of the conference req is
+// made for, if it goes to the host of the conference page or a subdomain of
+// it, so they aren't sent to Scholar or any other site.
+func addConferenceHeaders(req *http.Request) {
+	conf, ok := req.Context().Value(conferenceKey{}).(Conference)
+	if !ok {
+		return
+	}
+	confUrl, err := url.Parse(conf.URL)
+	if err != nil {
+		return
+	}
+	host, confHost := strings.ToLower(req.URL.Hostname()), strings.ToLower(confUrl.Hostname())
+	if host != confHost && !strings.HasSuffix(host, "."+confHost) {
+		return
+	}
+	for name, value := range conf.Headers {
+		req.Header.Set(name, value)
+	}
+	for name, value := range conf.Cookies {
+		req.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
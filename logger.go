@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	debugLevel logLevel = iota
+	infoLevel
+	warnLevel
+	errorLevel
+)
+
+var logLevelNames = map[logLevel]string{
+	debugLevel: "DEBUG",
+	infoLevel:  "INFO",
+	warnLevel:  "WARN",
+	errorLevel: "ERROR",
+}
+
+// parseLogLevel returns the level named by a -log-level value.
+func parseLogLevel(name string) (logLevel, bool) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// leveledLogger writes messages at or above its level to the standard logger,
+// or as one JSON object per line if json is set.
+type leveledLogger struct {
+	level logLevel
+	json  bool
+	// number of errors logged, whether or not they were written, guarded by
+	// mu since downloads log from several goroutines
+	mu     sync.Mutex
+	errors int
+}
+
+var (
+	logger = &leveledLogger{level: infoLevel}
+)
+
+// logEvent is a message logged with -log-json. The conference and URLs are
+// filled in from a *URLError among the message arguments.
+type logEvent struct {
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Message     string    `json:"message"`
+	Conference  string    `json:"conference,omitempty"`
+	PageUrl     string    `json:"pageUrl,omitempty"`
+	DownloadUrl string    `json:"downloadUrl,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+func (l *leveledLogger) logf(level logLevel, format string, v ...interface{}) {
+	if level >= errorLevel {
+		l.mu.Lock()
+		l.errors++
+		l.mu.Unlock()
+	}
+	if level < l.level {
+		return
+	}
+	if l.json {
+		l.writeJson(level, format, v...)
+		return
+	}
+	log.Printf(logLevelNames[level]+" "+format, v...)
+}
+
+func (l *leveledLogger) writeJson(level logLevel, format string, v ...interface{}) {
+	event := logEvent{
+		Time:    time.Now(),
+		Level:   strings.ToLower(logLevelNames[level]),
+		Message: fmt.Sprintf(format, v...),
+	}
+	for _, arg := range v {
+		err, ok := arg.(error)
+		if !ok {
+			continue
+		}
+		event.Error = err.Error()
+		var urlErr *URLError
+		if errors.As(err, &urlErr) {
+			event.Conference = urlErr.Conference
+			event.PageUrl = urlErr.PageUrl
+			event.DownloadUrl = urlErr.DownloadUrl
+			if urlErr.Err != nil {
+				event.Error = urlErr.Err.Error()
+			}
+		}
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("%s %s", logLevelNames[level], event.Message)
+		return
+	}
+	log.Writer().Write(append(line, '\n'))
+}
+
+func (l *leveledLogger) debugf(format string, v ...interface{}) {
+	l.logf(debugLevel, format, v...)
+}
+
+func (l *leveledLogger) infof(format string, v ...interface{}) {
+	l.logf(infoLevel, format, v...)
+}
+
+func (l *leveledLogger) warnf(format string, v ...interface{}) {
+	l.logf(warnLevel, format, v...)
+}
+
+func (l *leveledLogger) errorf(format string, v ...interface{}) {
+	l.logf(errorLevel, format, v...)
+}
+
+// Exit codes, so scripts can tell a broken setup from papers that failed.
+const (
+	exitFatal      = 1
+	exitFailures   = 2
+	exitIncomplete = 3
+)
+
+// fatalf logs the message regardless of the level and exits, like log.Fatalf.
+func (l *leveledLogger) fatalf(format string, v ...interface{}) {
+	l.exitf(exitFatal, format, v...)
+}
+
+// exitf logs the message regardless of the level and exits with code.
+func (l *leveledLogger) exitf(code int, format string, v ...interface{}) {
+	if l.json {
+		l.writeJson(errorLevel, format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+	os.Exit(code)
+}
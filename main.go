@@ -1,7 +1,16 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/yhat/scrape"
@@ -10,20 +19,40 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"os/signal"
 	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// userAgent identifies us to servers and is matched against robots.txt groups.
+const userAgent = "sec-fetch"
+
 type Conference struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
-	Year int    `json:"year"`
+	Name string `json:"name" yaml:"name"`
+	URL  string `json:"url" yaml:"url"`
+	Year int    `json:"year" yaml:"year"`
+	// Matcher, if given, finds the papers instead of a built-in parser
+	Matcher *MatcherSpec `json:"matcher,omitempty" yaml:"matcher,omitempty"`
+	// NextPage finds the link to the next page of papers, if the Matcher's
+	// papers are spread over several pages
+	NextPage *MatcherSpec `json:"nextPage,omitempty" yaml:"nextPage,omitempty"`
+	// Headers and Cookies are sent with the requests for the conference's
+	// pages and papers on its host, e.g. a Referer or a session cookie
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Cookies map[string]string `json:"cookies,omitempty" yaml:"cookies,omitempty"`
 }
 
 func (c *Conference) String() string {
@@ -32,15 +61,188 @@ func (c *Conference) String() string {
 
 type Config struct {
 	fetchTimeout    time.Duration
+	rpsPerHost      float64
+	burstPerHost    int
+	concurrency     int
+	perHost         int
+	maxBandwidth    byteRate
+	minFreeSpace    byteSize
 	conferencesFile string
 	outputDirectory string
+	nameBy          string
+	nameTemplate    string
+	bibtex          bool
+	saveAbstracts   bool
+	flat            bool
+	outputLayout    string
+	only            stringList
+	names           stringList
+	maxPapers       int
+	limit           int
+	verify          bool
+	resolve         bool
+	list            bool
+	resolveArgs     []string
+	clean           bool
+	cleanArgs       []string
+	resume          bool
+	restart         bool
+	ifModifiedSince bool
+	allLinks        bool
+	maxRedirects    int
+	minSize         int64
+	proxy           string
+	insecure        bool
+	caFile          string
+	authUser        string
+	authPass        string
+	authHeader      string
+	authHosts       stringList
+	scholarDelay    time.Duration
+	scholarBackoff  time.Duration
+	scholarRetries  int
+	refreshCache    bool
+	scholarUrl      string
+	cache           bool
+	cacheDirectory  string
+	cacheTtl        time.Duration
+	arxivFallback   bool
+	waybackFallback bool
+	force           bool
+	overwrite       bool
+	update          bool
+	preflight       bool
+	repair          bool
+	years           stringList
+	sinceYear       int
+	untilYear       int
+	dryRun          bool
+	metadataOnly    string
+	reportCsv       string
+	deadline        time.Duration
+	verbose         bool
+	quiet           bool
+	logLevel        string
+	logJson         bool
+	jsonEvents      bool
+	ignoreRobots    bool
 	conferences     []Conference
 }
 
 var (
-	config Config
+	config   Config
+	throttle *hostThrottle
+	// bandwidth limits the throughput of downloads with -max-bandwidth
+	bandwidth *bandwidthLimiter
+	// pool runs downloads in parallel with -concurrency, nil if they run one
+	// at a time
+	pool *downloadPool
+	// scholarThrottle paces Google Scholar, which blocks far sooner than others
+	scholarThrottle *hostThrottle
+	// httpClient is the client configured by the command line flags
+	httpClient = &http.Client{CheckRedirect: checkRedirect}
+	// cookieJar is httpClient's cookie jar, carrying session cookies landing
+	// pages set over to the downloads
+	cookieJar http.CookieJar
+	// fetcher sends every request, httpClient unless replaced by a fake
+	fetcher Fetcher = httpClient
+	// ieeeSecurityHost links papers behind a JS check, so its links are
+	// resolved through Scholar's "All N versions" page instead
+	ieeeSecurityHost = "www.ieee-security.org"
 )
 
+// stringList is a flag.Value collecting values from repeated and/or
+// comma-separated flags.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// splitFilter splits a conference filter of the form Name or Name:Year.
+func splitFilter(filter string) (name, year string) {
+	if i := strings.LastIndex(filter, ":"); i >= 0 {
+		return filter[:i], filter[i+1:]
+	}
+	return filter, ""
+}
+
+// filterConferences returns the conferences selected by any of the filters.
+// Names are matched case-insensitively.
+func filterConferences(conferences []Conference, filters []string) []Conference {
+	selected := make([]Conference, 0)
+	for _, conf := range conferences {
+		for _, filter := range filters {
+			name, year := splitFilter(filter)
+			if strings.EqualFold(conf.Name, name) && (year == "" || year == strconv.Itoa(conf.Year)) {
+				selected = append(selected, conf)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+// selectConferences applies the -only, -conference and -year flags to the
+// conference list.
+func selectConferences(conferences []Conference) []Conference {
+	if len(config.only) > 0 {
+		conferences = filterConferences(conferences, config.only)
+	}
+
+	selected := make([]Conference, 0)
+	for _, conf := range conferences {
+		if len(config.names) > 0 && !containsFold(config.names, conf.Name) {
+			continue
+		}
+		if len(config.years) > 0 && !containsFold(config.years, strconv.Itoa(conf.Year)) {
+			continue
+		}
+		if (config.sinceYear > 0 && conf.Year < config.sinceYear) || (config.untilYear > 0 && conf.Year > config.untilYear) {
+			continue
+		}
+		selected = append(selected, conf)
+	}
+	return selected
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeConferences lists the years available for each conference name, in
+// the order they first appear.
+func describeConferences(conferences []Conference) string {
+	names := make([]string, 0)
+	years := make(map[string][]string)
+	for _, conf := range conferences {
+		if _, ok := years[conf.Name]; !ok {
+			names = append(names, conf.Name)
+		}
+		years[conf.Name] = append(years[conf.Name], strconv.Itoa(conf.Year))
+	}
+
+	var description strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&description, "\n  %s: %s", name, strings.Join(years[name], ", "))
+	}
+	return description.String()
+}
+
 type FetchError struct {
 	Msg string
 }
@@ -49,490 +251,2431 @@ func (e FetchError) Error() string {
 	return e.Msg
 }
 
+// TooManyDownloadLinksError is TooManyDownloadLinksErr with the candidate
+// download URLs found on the page.
+type TooManyDownloadLinksError struct {
+	URLs []string
+}
+
+func (e *TooManyDownloadLinksError) Error() string {
+	return fmt.Sprintf("%s: %s", TooManyDownloadLinksErr, strings.Join(e.URLs, ", "))
+}
+
+func (e *TooManyDownloadLinksError) Is(target error) bool {
+	return target == TooManyDownloadLinksErr
+}
+
+// UnexpectedStatusError is UnexpectedStatusErr with the status the server
+// answered with.
+type UnexpectedStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", UnexpectedStatusErr, e.Status)
+}
+
+func (e *UnexpectedStatusError) Is(target error) bool {
+	return target == UnexpectedStatusErr
+}
+
+// URLError records the conference and URLs an error occurred for. Its fields
+// are empty where unknown.
+type URLError struct {
+	Conference  string
+	PageUrl     string
+	DownloadUrl string
+	Err         error
+}
+
+func (e *URLError) Error() string {
+	msg := e.Err.Error()
+	if e.Conference != "" {
+		msg = e.Conference + ": " + msg
+	}
+	if e.PageUrl != "" {
+		msg += " (page " + e.PageUrl + ")"
+	}
+	if e.DownloadUrl != "" {
+		msg += " (download " + e.DownloadUrl + ")"
+	}
+	return msg
+}
+
+func (e *URLError) Unwrap() error {
+	return e.Err
+}
+
 var (
 	MissingDownloadLinkErr  = FetchError{Msg: "no pdf download links found on page"}
 	TooManyDownloadLinksErr = FetchError{Msg: "too many pdf download links found on page"}
+	RobotsDisallowedErr     = FetchError{Msg: "disallowed by robots.txt"}
+	ScholarRateLimitedErr   = FetchError{Msg: "rate limited by Google Scholar"}
+	NoVersionLinkErr        = FetchError{Msg: "no \"All N versions\" link found on page"}
+	NoArxivMatchErr         = FetchError{Msg: "no paper with a matching title on arXiv"}
+	UnexpectedStatusErr     = FetchError{Msg: "unexpected HTTP status"}
+	TooSmallDownloadErr     = FetchError{Msg: "download too small to be a paper"}
+	TruncatedDownloadErr    = FetchError{Msg: "download shorter than its Content-Length"}
+	NotPdfDownloadErr       = FetchError{Msg: "download named .pdf is not a PDF"}
+	NotHtmlPageErr          = FetchError{Msg: "page is not HTML"}
+	NoWaybackSnapshotErr    = FetchError{Msg: "no snapshot in the Wayback Machine"}
+	LowDiskSpaceErr         = FetchError{Msg: "not enough free disk space"}
+	JSCheckedDownloadErr    = FetchError{Msg: "download redirects to " + ieeeSecurityHost + ", which checks JS for download"}
 )
 
+// confDirectoryPath returns the directory of the conference according to
+// -layout. With the flat layout it is the output directory itself.
+func confDirectoryPath(outputDirectory string, conf Conference) string {
+	switch config.outputLayout {
+	case "flat":
+		return outputDirectory
+	case "year-conf":
+		return path.Join(outputDirectory, strconv.Itoa(conf.Year), conf.Name)
+	}
+	return path.Join(outputDirectory, conf.Name, strconv.Itoa(conf.Year))
+}
+
+// confFilePath returns the path of the conference file with the given name,
+// such as its index, in the conference directory. In the flat layout the name
+// gets the flatPrefix of the conference like its papers.
+func confFilePath(directory string, conf Conference, name string) string {
+	if config.flat {
+		name = flatPrefix(conf) + name
+	}
+	return path.Join(directory, name)
+}
+
 func createConfDirectory(outputDirectory string, conf Conference) (string, error) {
-	// create conference directory
-	confDirectory := path.Join(outputDirectory, conf.Name, strconv.Itoa(conf.Year))
-	if _, err := os.Stat(confDirectory); os.IsNotExist(err) {
-		if err := os.MkdirAll(confDirectory, os.ModePerm); err != nil {
-			return "", err
-		}
+	// create conference directory, without a racy check whether it exists:
+	// MkdirAll succeeds if another goroutine created it first
+	confDirectory := confDirectoryPath(outputDirectory, conf)
+	if err := os.MkdirAll(confDirectory, os.ModePerm); err != nil {
+		return "", err
 	}
 	return confDirectory, nil
 }
 
-func getFullUrl(baseUrl, linkUrl string) (string, error) {
-	var fullUrl string
+// IndexEntry describes a single paper stored in a conference directory.
+type IndexEntry struct {
+	Title         string    `json:"title,omitempty"`
+	Authors       string    `json:"authors,omitempty"`
+	Abstract      string    `json:"abstract,omitempty"`
+	SourcePageUrl string    `json:"sourcePageUrl"`
+	DownloadUrl   string    `json:"downloadUrl"`
+	Filename      string    `json:"filename"`
+	DownloadedAt  time.Time `json:"downloadedAt"`
+	// Source is "arxiv" for papers fetched by -arxiv-fallback and "wayback"
+	// for ones fetched by -wayback-fallback instead of from the conference
+	Source string `json:"source,omitempty"`
+}
 
-	link, err := url.Parse(linkUrl)
+// conferenceRun holds the state accumulated while fetching a single conference.
+type conferenceRun struct {
+	conf      Conference
+	directory string
+	index     []IndexEntry
+	// download URL each file name was given to, for disambiguating duplicates
+	filenameUrls map[string]string
+	// number of papers named so far, for the {index} placeholder
+	named int
+	// download URLs already handled, whether the paper behind each ended up
+	// on disk, and how many times one came up again
+	seenUrls   map[string]bool
+	duplicates int
+	// number of papers actually downloaded, not counting existing files
+	downloaded int
+	// number of papers whose download URL was resolved, for -limit
+	resolved int
+	// number of papers that already existed or failed to download, and the
+	// bytes written for the downloaded ones
+	skipped int
+	failed  int
+	bytes   int64
+	// SHA-256 of each paper, keyed by file name
+	checksums map[string]string
+	// mu guards the run against its downloads running in the background, and
+	// downloads tracks them
+	mu        sync.Mutex
+	downloads sync.WaitGroup
+}
+
+// paperPath returns the path of the paper with the given file name.
+func (r *conferenceRun) paperPath(filename string) string {
+	return path.Join(r.directory, filename)
+}
+
+// filePath returns the path of the conference file with the given name.
+func (r *conferenceRun) filePath(name string) string {
+	return confFilePath(r.directory, r.conf, name)
+}
+
+// flatPrefix is what the file names of the conference's papers and files start
+// with in the flat layout, keeping different conferences apart.
+func flatPrefix(conf Conference) string {
+	return fmt.Sprintf("%s_%d_", sanitizeFilename(conf.Name), conf.Year)
+}
+
+// limitReached reports whether the -max-papers or -limit limit has been
+// reached for the conference.
+func (r *conferenceRun) limitReached() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.limitReachedLocked()
+}
+
+// limitReachedLocked is limitReached for callers holding r.mu.
+func (r *conferenceRun) limitReachedLocked() bool {
+	return (config.maxPapers > 0 && r.downloaded >= config.maxPapers) || (config.limit > 0 && r.resolved >= config.limit)
+}
+
+func newConferenceRun(conf Conference) (*conferenceRun, error) {
+	var err error
+	confDirectory := confDirectoryPath(config.outputDirectory, conf)
+	if !config.dryRun {
+		if confDirectory, err = createConfDirectory(config.outputDirectory, conf); err != nil {
+			return nil, err
+		}
+	}
+	checksums, err := readChecksums(confFilePath(confDirectory, conf, checksumsFilename))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	// names given to other papers by previous runs are taken too, so a new
+	// paper with the same name doesn't pass for one already downloaded
+	filenameUrls := make(map[string]string)
+	if index, err := readIndex(confFilePath(confDirectory, conf, indexFilename)); err == nil {
+		for _, entry := range index {
+			filenameUrls[entry.Filename] = entry.DownloadUrl
+		}
 	}
+	return &conferenceRun{
+		conf:         conf,
+		directory:    confDirectory,
+		filenameUrls: filenameUrls,
+		seenUrls:     make(map[string]bool),
+		checksums:    checksums,
+	}, nil
+}
 
-	if link.Host == "" || link.Scheme == "" {
-		base, err := url.Parse(baseUrl)
-		if err != nil {
-			return "", err
+// downloadPaper downloads paper with downloadPaperFrom, recording it in b. With
+// -concurrency above 1 the download runs in the background as soon as the pool
+// has a slot for it, and wait waits for it.
+func (r *conferenceRun) downloadPaper(ctx context.Context, paper Paper, b *batch) {
+	if pool == nil {
+		r.downloadPaperFrom(ctx, paper, "", b)
+		return
+	}
+	r.downloads.Add(1)
+	if b != nil {
+		b.downloads.Add(1)
+	}
+	go func() {
+		defer r.downloads.Done()
+		if b != nil {
+			defer b.downloads.Done()
 		}
-		full, err := base.Parse(linkUrl)
+		release, err := pool.acquire(ctx, paper.DownloadURL)
 		if err != nil {
-			return "", err
+			r.mu.Lock()
+			b.fail()
+			r.mu.Unlock()
+			return
 		}
-		fullUrl = full.String()
-	} else {
-		fullUrl = linkUrl
-	}
+		defer release()
+		r.downloadPaperFrom(ctx, paper, "", b)
+	}()
+}
 
-	return fullUrl, nil
+// wait waits for the downloads running in the background.
+func (r *conferenceRun) wait() {
+	r.downloads.Wait()
 }
 
-func downloadFile(url, filepath string) error {
-	if _, err := os.Stat(filepath); !os.IsNotExist(err) {
-		log.Printf("skipping download, file already exists: %s, \n", filepath)
-		return nil
+// downloadPaperFrom stores paper in the conference directory and records it in
+// the conference index and in b. The parser must fill in the source page and
+// download URLs, and any of the title, authors and abstract it knows. source
+// is the Source of the index entry; only papers from the conference itself,
+// with an empty source, fall back to the Wayback Machine and arXiv on failure.
+// It reports whether the paper is on disk now, from the download URL or a
+// fallback, or would be in a dry run.
+func (r *conferenceRun) downloadPaperFrom(ctx context.Context, paper Paper, source string, b *batch) bool {
+	entry := IndexEntry{
+		Title:         paper.Title,
+		Authors:       paper.Authors,
+		Abstract:      paper.Abstract,
+		SourcePageUrl: paper.SourceURL,
+		DownloadUrl:   paper.DownloadURL,
+		Source:        source,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// different pages and Scholar versions can resolve to the same PDF
+	if onDisk, seen := r.seenUrls[entry.DownloadUrl]; seen {
+		logger.debugf("skipping duplicate download URL: %s", entry.DownloadUrl)
+		r.duplicates++
+		return onDisk
+	}
+	// downloads queued before the limit was reached may find it reached
+	if source == "" && r.limitReachedLocked() {
+		b.fail()
+		return false
+	}
+	r.seenUrls[entry.DownloadUrl] = false
+	r.resolved++
+	emitEvent(r.paperEvent(paperResolvedEvent, entry))
+	if config.metadataOnly != "" {
+		metadata = append(metadata, PaperMetadata{
+			Conference: paper.Conference.Name,
+			Year:       paper.Conference.Year,
+			Title:      entry.Title,
+			PageUrl:    entry.SourcePageUrl,
+			PdfUrl:     entry.DownloadUrl,
+		})
+		r.seenUrls[entry.DownloadUrl] = true
+		return true
 	}
 
-	// Create the file
-	out, err := os.Create(filepath)
+	entry.Filename = r.filename(entry.Title, entry.DownloadUrl)
+	filepath := r.paperPath(entry.Filename)
+	if config.dryRun {
+		logger.infof("dry run, not downloading: %s -> %s", entry.DownloadUrl, filepath)
+		r.seenUrls[entry.DownloadUrl] = true
+		return true
+	}
+	// the server's name for the file beats one made up from the URL
+	var rename func(string) string
+	if config.nameBy == "url" && config.nameTemplate == "" {
+		rename = func(serverName string) string {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return r.paperPath(r.claimFilename(serverName, entry.DownloadUrl))
+		}
+	}
+	emitEvent(r.paperEvent(downloadStartedEvent, entry))
+	started := time.Now()
+	// other downloads go on meanwhile
+	r.mu.Unlock()
+	result, err := downloadFile(ctx, entry.DownloadUrl, filepath, rename)
+	r.mu.Lock()
+	filepath, written := result.Path, result.Bytes
+	entry.Filename = path.Base(filepath)
 	if err != nil {
-		return err
+		event := r.paperEvent(downloadFailedEvent, entry)
+		event.Error = err.Error()
+		emitEvent(event)
+		r.reportDownload(entry, filepath, "", 0, "", err)
+	} else if written > 0 {
+		event := r.paperEvent(downloadCompletedEvent, entry)
+		event.Path = filepath
+		event.Bytes = written
+		event.Seconds = time.Since(started).Seconds()
+		emitEvent(event)
+	} else {
+		event := r.paperEvent(downloadSkippedEvent, entry)
+		event.Path = filepath
+		emitEvent(event)
+	}
+	if errors.Is(err, RobotsDisallowedErr) {
+		// doRequest warned already, and it's not ours to fix
+		return false
+	} else if errors.Is(err, LowDiskSpaceErr) {
+		// the download a fallback stands in for counts as failed instead
+		if source == "" {
+			r.failed++
+			b.fail()
+		}
+		logger.warnf("skipping download: %s", &URLError{
+			Conference:  r.conf.String(),
+			PageUrl:     entry.SourcePageUrl,
+			DownloadUrl: entry.DownloadUrl,
+			Err:         err,
+		})
+		return false
+	} else if err != nil {
+		failure := &URLError{
+			Conference:  r.conf.String(),
+			PageUrl:     entry.SourcePageUrl,
+			DownloadUrl: entry.DownloadUrl,
+			Err:         err,
+		}
+		// dead links may live on in the Wayback Machine, and papers behind
+		// the JS check or gone altogether on arXiv. Only papers none of
+		// them has count as failed, once, even if a fallback failed too.
+		if source == "" {
+			var statusErr *UnexpectedStatusError
+			notFound := errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+			r.mu.Unlock()
+			recovered := notFound && r.downloadFromWayback(ctx, paper, entry.Filename, b) || r.downloadFromArxiv(ctx, paper, b)
+			r.mu.Lock()
+			if recovered {
+				return true
+			}
+			r.failed++
+			b.fail()
+		}
+		logger.errorf("failed to download: %s", failure)
+		return false
+	}
+	if written > 0 {
+		r.downloaded++
+		r.bytes += written
+	} else {
+		r.skipped++
 	}
-	defer out.Close()
 
-	// Get the data
-	resp, err := http.Get(url)
+	info, err := os.Stat(filepath)
 	if err != nil {
-		return err
+		logger.errorf("%s", err)
+		return false
+	}
+	entry.DownloadedAt = info.ModTime()
+	r.index = append(r.index, entry)
+	b.record(entry)
+	if config.saveAbstracts && entry.Abstract != "" {
+		if err := writeAbstract(filepath, entry.Abstract); err != nil {
+			logger.errorf("%s", err)
+		}
 	}
-	defer resp.Body.Close()
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+	sum, err := sha256File(filepath)
 	if err != nil {
-		return err
+		logger.errorf("%s", err)
+		return false
 	}
-
-	return nil
+	r.checksums[entry.Filename] = sum
+	manifest = append(manifest, r.manifestEntry(entry, info.Size()))
+	status := "skipped"
+	if written > 0 {
+		status = "downloaded"
+	}
+	r.reportDownload(entry, filepath, status, info.Size(), sum, nil)
+	r.seenUrls[entry.DownloadUrl] = true
+	return true
 }
 
-func getDownloadUrl(pageUrl string, matcher scrape.Matcher) (string, error) {
-	response, err := http.Get(pageUrl)
-	if err != nil {
-		return "", err
-	}
+// writeAbstract writes the abstract of the paper at filepath next to it, as
+// <paper basename>.abstract.txt.
+func writeAbstract(filepath, abstract string) error {
+	abstractPath := strings.TrimSuffix(filepath, path.Ext(filepath)) + ".abstract.txt"
+	return ioutil.WriteFile(abstractPath, []byte(abstract+"\n"), 0644)
+}
 
-	root, err := html.Parse(response.Body)
-	if err != nil {
-		return "", err
+// manifestEntry describes a paper of the conference for the manifest.
+func (r *conferenceRun) manifestEntry(entry IndexEntry, size int64) ManifestEntry {
+	validator, _ := downloadValidator(r.paperPath(entry.Filename))
+	return ManifestEntry{
+		Conference:    r.conf.Name,
+		Year:          r.conf.Year,
+		Title:         entry.Title,
+		SourcePageUrl: entry.SourcePageUrl,
+		DownloadUrl:   entry.DownloadUrl,
+		Path:          r.paperPath(entry.Filename),
+		Size:          size,
+		Sha256:        r.checksums[entry.Filename],
+		Source:        entry.Source,
+		ETag:          validator.ETag,
+		LastModified:  validator.LastModified,
 	}
+}
 
-	// grab all paper links
-	pageNodes := scrape.FindAll(root, matcher)
-	if len(pageNodes) < 1 {
-		return "", MissingDownloadLinkErr
+// resumeConference loads the conference as indexed by a previous run, or
+// returns nil if it hasn't been fetched before.
+func resumeConference(conf Conference) (*conferenceRun, error) {
+	index, err := readIndex(confFilePath(confDirectoryPath(config.outputDirectory, conf), conf, indexFilename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
 	}
 
-	fileUrl, err := getFullUrl(pageUrl, scrape.Attr(pageNodes[0], "href"))
+	run, err := newConferenceRun(conf)
 	if err != nil {
-		return "", err
-	}
-
-	if len(pageNodes) > 1 {
-		return fileUrl, TooManyDownloadLinksErr
+		return nil, err
 	}
-
-	if strings.Contains(fileUrl, "www.ieee-security.org") {
-		allVersionsRegex := regexp.MustCompile(`^All [\d]+ versions$`)
-		allVersionsMatcher := func(n *html.Node) bool {
-			if n.DataAtom == atom.A {
-				return allVersionsRegex.MatchString(scrape.Text(n))
-			}
-			return false
+	run.index = index
+	for _, entry := range index {
+		info, err := os.Stat(run.paperPath(entry.Filename))
+		if err != nil {
+			logger.warnf("%s", err)
+			continue
 		}
+		manifest = append(manifest, run.manifestEntry(entry, info.Size()))
+	}
+	return run, nil
+}
 
-		versionLink, ok := scrape.Find(root, allVersionsMatcher)
-		if !ok {
-			log.Fatalf("no version link found for: %s", fileUrl)
+// filename picks the local file name for a paper according to the
+// -name-template or -name-by flag, falling back to the download URL basename
+// when the title is unknown and to the title when the URL has no basename.
+func (r *conferenceRun) filename(title, downloadUrl string) string {
+	r.named++
+	name := ""
+	if config.nameTemplate != "" {
+		name = r.expandNameTemplate(title)
+	} else if config.nameBy == "title" {
+		if slug := slugify(title); slug != "" {
+			name = slug + ".pdf"
 		}
-		versionUrl, err := getFullUrl(pageUrl, scrape.Attr(versionLink, "href"))
-		if err != nil {
-			return "", err
+	}
+	if name == "" {
+		splitUrl := strings.Split(downloadUrl, "/")
+		name = sanitizeFilename(splitUrl[len(splitUrl)-1])
+	}
+	if name == "" {
+		if slug := slugify(title); slug != "" {
+			name = slug + ".pdf"
+		} else {
+			name = "paper.pdf"
 		}
+	}
+	return r.claimFilename(name, downloadUrl)
+}
 
-		urlMatcher := func(n *html.Node) bool {
-			// must check for nil values
-			if n.DataAtom == atom.A && n.Parent != nil {
-				href := scrape.Attr(n, "href")
-				return strings.HasSuffix(href, ".pdf") && scrape.Attr(n.Parent, "class") == "gs_or_ggsm" && !strings.Contains(href, "www.ieee-security.org")
-			}
-			return false
-		}
+// nameTemplatePlaceholder matches the placeholders of -name-template.
+var nameTemplatePlaceholder = regexp.MustCompile(`\{(\w+)\}`)
 
-		return getDownloadUrl(versionUrl, urlMatcher)
+// expandNameTemplate fills in the -name-template placeholders for the paper
+// being named, returning "" if the template needs a title that isn't known.
+func (r *conferenceRun) expandNameTemplate(title string) string {
+	slug := slugify(title)
+	if slug == "" && strings.Contains(config.nameTemplate, "{title}") {
+		return ""
+	}
+	name := nameTemplatePlaceholder.ReplaceAllStringFunc(config.nameTemplate, func(placeholder string) string {
+		switch placeholder {
+		case "{conf}":
+			return r.conf.Name
+		case "{year}":
+			return strconv.Itoa(r.conf.Year)
+		case "{title}":
+			return slug
+		case "{index}":
+			return fmt.Sprintf("%03d", r.named)
+		}
+		return placeholder
+	})
+	name = sanitizeFilename(name)
+	if name != "" && path.Ext(name) == "" {
+		name += ".pdf"
 	}
+	return name
+}
 
-	return fileUrl, nil
+// claimFilename reserves name for the paper at downloadUrl, appending a counter
+// if it was already given to a different URL. With -flat the name is prefixed
+// by the conference and year.
+func (r *conferenceRun) claimFilename(name, downloadUrl string) string {
+	if config.flat && !strings.HasPrefix(name, flatPrefix(r.conf)) {
+		name = flatPrefix(r.conf) + name
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for count := 2; ; count++ {
+		if claimed, ok := r.filenameUrls[name]; !ok || claimed == downloadUrl {
+			break
+		}
+		name = fmt.Sprintf("%s-%d%s", base, count, ext)
+	}
+	r.filenameUrls[name] = downloadUrl
+	return name
 }
 
-func getLinks(pageUrl string, matcher scrape.Matcher) ([]string, error) {
-	response, err := http.Get(pageUrl)
+const indexFilename = "index.json"
+
+// writeIndex writes the conference index to index.json in the conference directory.
+func (r *conferenceRun) writeIndex() error {
+	bytes, err := json.MarshalIndent(r.index, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	return ioutil.WriteFile(r.filePath(indexFilename), bytes, 0644)
+}
 
-	root, err := html.Parse(response.Body)
+// readIndex reads the conference index a previous run wrote to filepath.
+func readIndex(filepath string) ([]IndexEntry, error) {
+	bytes, err := ioutil.ReadFile(filepath)
 	if err != nil {
 		return nil, err
 	}
+	var index []IndexEntry
+	err = json.Unmarshal(bytes, &index)
+	return index, err
+}
 
-	// grab all paper links
-	pageNodes := scrape.FindAll(root, matcher)
-	pages := make([]string, 0)
-	for _, page := range pageNodes {
-		url, err := getFullUrl(pageUrl, scrape.Attr(page, "href"))
-		if err != nil {
-			log.Fatal(err)
+// save writes the conference checksums and, if all of the conference was
+// fetched, its index and, if enabled, the BibTeX references. The index marks
+// the conference as done for -resume, so it isn't written for interrupted
+// runs. Nothing is written in dry-run mode.
+func (r *conferenceRun) save(complete bool) error {
+	if config.dryRun {
+		return nil
+	}
+	if err := r.writeChecksums(); err != nil {
+		return err
+	}
+	if !complete {
+		return nil
+	}
+	if err := r.writeIndex(); err != nil {
+		return err
+	}
+	if config.bibtex {
+		return r.writeBibtex()
+	}
+	return nil
+}
+
+// maxSlugLength is how many bytes a slug has at most, leaving room below the
+// usual 255 byte file name limit for prefixes and numbering.
+const maxSlugLength = 100
+
+// slugify turns a paper title into a file name safe string: lowercased, with
+// runs of anything other than letters and digits replaced by a single hyphen.
+func slugify(title string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, c := range strings.ToLower(title) {
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			slug.WriteRune(c)
+			hyphen = false
+		} else if !hyphen && slug.Len() > 0 {
+			slug.WriteRune('-')
+			hyphen = true
 		}
-		pages = append(pages, url)
 	}
 
-	return pages, nil
+	truncated := slug.String()
+	if len(truncated) > maxSlugLength {
+		// cut on a rune boundary
+		n := maxSlugLength
+		for !utf8.RuneStart(truncated[n]) {
+			n--
+		}
+		truncated = truncated[:n]
+	}
+	return strings.Trim(truncated, "-")
 }
 
-func getPaperTitles(pageUrl string, matcher scrape.Matcher) ([]string, error) {
-	response, err := http.Get(pageUrl)
+func getFullUrl(baseUrl, linkUrl string) (string, error) {
+	var fullUrl string
+
+	link, err := url.Parse(linkUrl)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	if link.Host == "" || link.Scheme == "" {
+		base, err := url.Parse(baseUrl)
+		if err != nil {
+			return "", err
+		}
+		full, err := base.Parse(linkUrl)
+		if err != nil {
+			return "", err
+		}
+		fullUrl = full.String()
+	} else {
+		fullUrl = linkUrl
 	}
 
-	root, err := html.Parse(response.Body)
+	return fullUrl, nil
+}
+
+// newRequest creates a GET request identifying ourselves with userAgent.
+func newRequest(ctx context.Context, url string) (*http.Request, error) {
+	return newMethodRequest(ctx, "GET", url)
+}
+
+// newMethodRequest is newRequest for other methods than GET.
+func newMethodRequest(ctx context.Context, method, url string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Set("User-Agent", userAgent)
+	addConferenceHeaders(req)
+	return req, nil
+}
 
-	// grab all paper titles
-	titleNodes := scrape.FindAll(root, matcher)
-	titles := make([]string, 0)
-	for _, title := range titleNodes {
-		title := scrape.Text(title)
+// Fetcher sends HTTP requests. *http.Client implements it, and so can fakes
+// that answer with canned responses instead of going to the network.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
 
-		titles = append(titles, title)
+// checkRedirect stops following redirects after -max-redirects of them, or
+// as soon as they go around in a loop. Coming back to a URL with new cookies,
+// as landing pages that set a session cookie do, isn't a loop.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	cookies := jarCookies(req.URL)
+	for _, previous := range via {
+		if previous.URL.String() == req.URL.String() && previous.Header.Get("Cookie") == cookies {
+			return fmt.Errorf("redirect loop at %s", req.URL)
+		}
 	}
-
-	return titles, nil
+	if len(via) > config.maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", config.maxRedirects)
+	}
+	return nil
 }
 
-// Pre-main bind flags to variables
-func init() {
-	flag.DurationVar(&config.fetchTimeout, "timeout", 2*time.Second, "timeout between downloading papers")
-	flag.StringVar(&config.conferencesFile, "config", "conferences.json", "JSON file listing conferences")
-	flag.StringVar(&config.outputDirectory, "output-dir", "papers", "output directory for storing papers")
-	flag.Parse()
+// jarCookies returns the Cookie header cookieJar sends to u.
+func jarCookies(u *url.URL) string {
+	if cookieJar == nil {
+		return ""
+	}
+	req := &http.Request{Header: make(http.Header)}
+	for _, cookie := range cookieJar.Cookies(u) {
+		req.AddCookie(cookie)
+	}
+	return req.Header.Get("Cookie")
+}
 
-	// create output directory
-	if _, err := os.Stat(config.outputDirectory); os.IsNotExist(err) {
-		if err := os.MkdirAll(config.outputDirectory, os.ModePerm); err != nil {
-			log.Fatal(err)
-		}
+// doRequest sends req once the politeness delay for the host has passed. URLs
+// disallowed by the host's robots.txt are skipped unless -ignore-robots is set.
+func doRequest(req *http.Request) (*http.Response, error) {
+	url := req.URL.String()
+	if !config.ignoreRobots && !robots.allowed(req.Context(), url) {
+		logger.warnf("skipping %s, disallowed by robots.txt", url)
+		return nil, RobotsDisallowedErr
+	}
+	t := throttle
+	if isScholarUrl(url) {
+		t = scholarThrottle
 	}
+	if err := t.wait(req.Context(), url); err != nil {
+		return nil, err
+	}
+	authorize(req)
+	return fetcher.Do(req)
 }
 
-func main() {
-	conferencesFile, err := os.Open(config.conferencesFile)
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := newRequest(ctx, url)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer conferencesFile.Close()
+	return doRequest(req)
+}
 
-	bytes, _ := ioutil.ReadAll(conferencesFile)
-	json.Unmarshal(bytes, &config.conferences)
+// checkFreeSpace returns LowDiskSpaceErr if writing size more bytes to
+// directory would leave less than -min-free-space free. Unknown sizes count as
+// nothing, and so does free space that can't be determined.
+func checkFreeSpace(directory string, size int64) error {
+	if config.minFreeSpace <= 0 {
+		return nil
+	}
+	free, err := freeSpace(directory)
+	if err != nil {
+		logger.debugf("can't check free space of %s: %s", directory, err)
+		return nil
+	}
+	if size < 0 {
+		size = 0
+	}
+	if free-size < int64(config.minFreeSpace) {
+		return fmt.Errorf("%w: %s free in %s, -min-free-space is %s", LowDiskSpaceErr, formatBytes(free), directory, formatBytes(int64(config.minFreeSpace)))
+	}
+	return nil
+}
 
-	for _, conf := range config.conferences {
-		switch conf.Name {
-		case "USENIX":
-			confDirectory, err := createConfDirectory(config.outputDirectory, conf)
-			if err != nil {
-				log.Fatal(err)
+// unchangedRemotely asks the server with a HEAD request whether the file at url
+// is the same as the one at filepath: as long as the local one, and not
+// modified after it was stored. Servers that don't answer HEAD requests or
+// don't give the length are assumed to have changed files.
+func unchangedRemotely(ctx context.Context, url, filepath string) bool {
+	info, err := os.Stat(filepath)
+	if err != nil {
+		return false
+	}
+	req, err := newMethodRequest(ctx, "HEAD", url)
+	if err != nil {
+		return false
+	}
+	resp, err := doRequest(req)
+	if err != nil {
+		logger.debugf("preflight of %s failed: %s", url, err)
+		return false
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || resp.ContentLength < 0 {
+		return false
+	}
+	if resp.ContentLength != info.Size() {
+		return false
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && lastModified.After(info.ModTime()) {
+		return false
+	}
+	return true
+}
+
+// downloadFile downloads url to filepath, returning the path used and the
+// number of bytes written, which is 0 if the file already existed. If rename is given and
+// the server suggests a file name in a Content-Disposition header or redirects
+// to a URL with a different basename, the path returned by rename for that
+// name is used instead. The data is written to a
+// .part file that is renamed into place once complete, and a .part file left
+// behind by an interrupted download is resumed if the server supports range
+// requests. Existing files are skipped unless -overwrite or -update is set, in
+// which case they are only replaced once the new copy is complete. Files the
+// manifest has an ETag or Last-Modified for are requested conditionally and
+// kept if the server answers 304 Not Modified, otherwise with -preflight or
+// -update they are only replaced if a HEAD request suggests they changed. An
+// HTML page that redirects with a meta refresh or a JavaScript location
+// assignment is followed once.
+func downloadFile(ctx context.Context, url, filepath string, rename func(string) string) (DownloadResult, error) {
+	return downloadFileFollowing(ctx, url, filepath, rename, true)
+}
+
+// downloadFileFollowing is downloadFile, following a redirecting HTML page only
+// if followPage is set.
+func downloadFileFollowing(ctx context.Context, url, filepath string, rename func(string) string, followPage bool) (DownloadResult, error) {
+	_, err := os.Stat(filepath)
+	exists := !os.IsNotExist(err)
+	replace := config.overwrite || config.update
+	if exists && !replace {
+		logger.infof("skipping download, file already exists: %s", filepath)
+		return DownloadResult{Path: filepath}, nil
+	}
+	validator, known := downloadValidator(filepath)
+	if exists && !known && (config.preflight || config.update) && unchangedRemotely(ctx, url, filepath) {
+		logger.infof("skipping download, file is unchanged on the server: %s", filepath)
+		return DownloadResult{Path: filepath}, nil
+	}
+
+	if err := checkFreeSpace(path.Dir(filepath), 0); err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+
+	req, err := newRequest(ctx, url)
+	if err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+	if exists && known {
+		if validator.ETag != "" {
+			req.Header.Set("If-None-Match", validator.ETag)
+		}
+		if validator.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validator.LastModified)
+		}
+	}
+	partpath := filepath + ".part"
+	var offset int64
+	if info, err := os.Stat(partpath); err == nil && info.Size() > 0 {
+		offset = info.Size()
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	// Get the data
+	resp, err := doRequest(req)
+	if err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && exists {
+		logger.infof("skipping download, file is unchanged on the server: %s", filepath)
+		return DownloadResult{Path: filepath}, nil
+	}
+
+	// error pages must not end up in place of the paper
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			// the partial file is useless for resuming, start over next time
+			os.Remove(partpath)
+		}
+		return DownloadResult{Path: filepath}, &UnexpectedStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	if err := checkFreeSpace(path.Dir(filepath), resp.ContentLength); err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+
+	finalUrl := resp.Request.URL
+	if finalUrl.String() != url {
+		logger.debugf("%s redirected to %s", url, finalUrl)
+	}
+	if strings.Contains(finalUrl.Host, ieeeSecurityHost) {
+		return DownloadResult{Path: filepath}, JSCheckedDownloadErr
+	}
+
+	body := io.Reader(resp.Body)
+	if isHtmlResponse(resp) {
+		head := make([]byte, maxRedirectPageSize)
+		n, err := io.ReadFull(resp.Body, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return DownloadResult{Path: filepath}, err
+		}
+		head = head[:n]
+		if target := pageRedirectTarget(head); target != "" && followPage {
+			targetUrl, err := getFullUrl(finalUrl.String(), target)
+			if err != nil {
+				return DownloadResult{Path: filepath}, err
+			}
+			logger.debugf("%s redirects to %s from the page", finalUrl, targetUrl)
+			resp.Body.Close()
+			return downloadFileFollowing(ctx, targetUrl, filepath, rename, false)
+		}
+		// not a redirect, the PDF check has the final say
+		body = io.MultiReader(bytes.NewReader(head), resp.Body)
+	}
+
+	// The .part file keeps the URL based name, so an interrupted download is
+	// found again before the server names it
+	serverName := contentDispositionFilename(resp)
+	if serverName == "" && finalUrl.String() != url {
+		serverName = sanitizeFilename(path.Base(finalUrl.Path))
+	}
+	if rename != nil && serverName != "" {
+		if renamed := rename(serverName); renamed != filepath {
+			filepath = renamed
+			_, err := os.Stat(filepath)
+			exists = !os.IsNotExist(err)
+			if exists && !replace {
+				logger.infof("skipping download, file already exists: %s", filepath)
+				return DownloadResult{Path: filepath}, nil
+			}
+		}
+	}
+
+	// Append to the partial file if the server resumed where it left off,
+	// otherwise start from scratch
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		if resp.StatusCode == http.StatusPartialContent && strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", offset)) {
+			logger.infof("resuming download of %s at byte %d", filepath, offset)
+			flags = os.O_WRONLY | os.O_APPEND
+		} else {
+			logger.infof("server did not resume download of %s, restarting", filepath)
+		}
+	}
+
+	// Create the file
+	out, err := os.OpenFile(partpath, flags, 0644)
+	if err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+	defer out.Close()
+
+	// Write the body to file, discarding it if we were interrupted
+	written, err := io.Copy(out, limitBandwidth(ctx, body))
+	if err != nil {
+		if ctx.Err() != nil {
+			out.Close()
+			os.Remove(partpath)
+		}
+		return DownloadResult{Path: filepath}, err
+	}
+	if err := out.Close(); err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		os.Remove(partpath)
+		return DownloadResult{Path: filepath}, fmt.Errorf("%w: expected %d bytes, got %d", TruncatedDownloadErr, resp.ContentLength, written)
+	}
+	// an empty or tiny body would otherwise pass for a finished download forever
+	if info, err := os.Stat(partpath); err != nil {
+		return DownloadResult{Path: filepath}, err
+	} else if info.Size() < config.minSize {
+		os.Remove(partpath)
+		return DownloadResult{Path: filepath}, fmt.Errorf("%w: got %d bytes, -min-size is %d", TooSmallDownloadErr, info.Size(), config.minSize)
+	}
+	// stub pages asking to enable JavaScript come with .pdf URLs too
+	if strings.EqualFold(path.Ext(filepath), ".pdf") && !hasPdfHeader(partpath) {
+		os.Remove(partpath)
+		return DownloadResult{Path: filepath}, fmt.Errorf("%w: served as %q", NotPdfDownloadErr, resp.Header.Get("Content-Type"))
+	}
+	if err := os.Rename(partpath, filepath); err != nil {
+		return DownloadResult{Path: filepath}, err
+	}
+	setDownloadValidator(filepath, pageValidator{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")})
+
+	if exists {
+		logger.infof("overwrote %s", filepath)
+	} else {
+		logger.infof("downloaded %s", filepath)
+	}
+	return DownloadResult{Path: filepath, Bytes: written}, nil
+}
+
+// hasPdfHeader reports whether the file at filepath starts with the %PDF- magic
+// bytes.
+func hasPdfHeader(filepath string) bool {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, 5)
+	_, err = io.ReadFull(f, header)
+	return err == nil && string(header) == "%PDF-"
+}
+
+// maxRedirectPageSize is how much of an HTML page served for a download is
+// searched for a redirect.
+const maxRedirectPageSize = 64 * 1024
+
+var (
+	// <meta http-equiv="refresh" content="0; url=...">, in either attribute order
+	metaRefreshRegex = regexp.MustCompile(`(?is)<meta[^>]*http-equiv\s*=\s*["']?refresh["']?[^>]*>`)
+	refreshUrlRegex  = regexp.MustCompile(`(?is)content\s*=\s*["']?\s*\d*\s*;?\s*url\s*=\s*['"]?([^"'>\s]+)`)
+	// window.location = "...", location.href = '...', location.replace("...")
+	jsRedirectRegex = regexp.MustCompile(`(?:window\.|document\.)?location(?:\.href)?\s*(?:=\s*|\.replace\(\s*|\.assign\(\s*)["']([^"']+)["']`)
+)
+
+func isHtmlResponse(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// pageRedirectTarget returns the URL an HTML page redirects to with a meta
+// refresh or a JavaScript location assignment, or "" if it doesn't.
+func pageRedirectTarget(page []byte) string {
+	if meta := metaRefreshRegex.Find(page); meta != nil {
+		if match := refreshUrlRegex.FindSubmatch(meta); match != nil {
+			return html.UnescapeString(string(match[1]))
+		}
+	}
+	if match := jsRedirectRegex.FindSubmatch(page); match != nil {
+		return html.UnescapeString(string(match[1]))
+	}
+	return ""
+}
+
+// contentDispositionFilename returns the file name the server suggests in the
+// Content-Disposition header of resp, or "" if it doesn't suggest a usable one.
+func contentDispositionFilename(resp *http.Response) string {
+	_, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition"))
+	if err != nil {
+		return ""
+	}
+	return sanitizeFilename(params["filename"])
+}
+
+// sanitizeFilename strips directories and characters that aren't safe in file
+// names from a name given by a server, returning "" if nothing usable is left.
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.Replace(name, `\`, "/", -1))
+	name = strings.Map(func(c rune) rune {
+		if unicode.IsControl(c) || strings.ContainsRune(`<>:"|?*`, c) {
+			return '_'
+		}
+		return c
+	}, name)
+	return strings.TrimLeft(strings.Trim(strings.TrimSpace(name), "/"), ".")
+}
+
+// decodeBody wraps the response body to undo any Content-Encoding the
+// transport didn't already decompress. Encodings we can't undo are an error,
+// rather than garbage handed to the parser.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// servers disagree on whether deflate is zlib wrapped or raw
+		body := bufio.NewReader(resp.Body)
+		if header, err := body.Peek(2); err == nil && isZlibHeader(header) {
+			return zlib.NewReader(body)
+		}
+		return flate.NewReader(body), nil
+	case "", "identity":
+		return resp.Body, nil
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+}
+
+// isZlibHeader reports whether header starts a zlib stream compressed with
+// deflate, as opposed to a raw deflate stream.
+func isZlibHeader(header []byte) bool {
+	return header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// fetchHTML fetches and parses the page at pageUrl. Google Scholar pages are
+// retried while Scholar rate limits us.
+func fetchHTML(ctx context.Context, pageUrl string) (*html.Node, error) {
+	if isScholarUrl(pageUrl) {
+		return fetchScholarHTML(ctx, pageUrl)
+	}
+	return fetchPage(ctx, pageUrl)
+}
+
+// fetchPage fetches and parses the page at pageUrl once, or parses the copy
+// -if-modified-since already got or the cached copy if -cache is set.
+func fetchPage(ctx context.Context, pageUrl string) (*html.Node, error) {
+	if page, ok := takePrefetchedPage(pageUrl); ok {
+		if config.cache {
+			if err := storeCachedPage(pageUrl, page); err != nil {
+				logger.warnf("could not cache %s: %s", pageUrl, err)
+			}
+		}
+		return html.Parse(bytes.NewReader(page))
+	}
+	if page, ok := cachedPage(pageUrl); ok {
+		logger.debugf("using cached copy of %s", pageUrl)
+		return html.Parse(bytes.NewReader(page))
+	}
+
+	response, err := httpGet(ctx, pageUrl)
+	if err != nil {
+		return nil, &URLError{PageUrl: pageUrl, Err: err}
+	}
+	defer response.Body.Close()
+
+	body, err := decodeBody(response)
+	if err != nil {
+		return nil, &URLError{PageUrl: pageUrl, Err: err}
+	}
+	if isScholarUrl(pageUrl) {
+		if body, err = checkScholarResponse(response, body); err != nil {
+			return nil, &URLError{PageUrl: pageUrl, Err: err}
+		}
+	}
+	if err := checkHtmlResponse(response); err != nil {
+		return nil, &URLError{PageUrl: pageUrl, Err: err}
+	}
+	if config.cache && isCacheable(response) {
+		page, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, &URLError{PageUrl: pageUrl, Err: err}
+		}
+		if err := storeCachedPage(pageUrl, page); err != nil {
+			logger.warnf("could not cache %s: %s", pageUrl, err)
+		}
+		body = bytes.NewReader(page)
+	}
+	return html.Parse(body)
+}
+
+// checkHtmlResponse returns an error unless resp is a successful response with
+// an HTML page, so error pages, login pages behind redirects and PDFs aren't
+// scraped for links that can't be there.
+func checkHtmlResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &UnexpectedStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return fmt.Errorf("%w: got %q", NotHtmlPageErr, contentType)
+	}
+	return nil
+}
+
+// getDownloadUrl fetches the source page of paper and resolves its download
+// URL there, like findDownloadUrl.
+func getDownloadUrl(ctx context.Context, paper Paper, matcher scrape.Matcher) (Paper, error) {
+	root, err := fetchHTML(ctx, paper.SourceURL)
+	if err != nil {
+		return paper, err
+	}
+	return findDownloadUrl(ctx, paper, root, matcher)
+}
+
+// getDownloadUrls returns every download link matched by matcher on the page
+// at pageUrl, for pages that link to several versions of a paper.
+func getDownloadUrls(ctx context.Context, pageUrl string, matcher scrape.Matcher) ([]string, error) {
+	root, err := fetchHTML(ctx, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	return findDownloadUrls(pageUrl, root, matcher)
+}
+
+// findDownloadUrls returns every download link matched by matcher in the
+// already parsed page at pageUrl, without duplicates.
+func findDownloadUrls(pageUrl string, root *html.Node, matcher scrape.Matcher) ([]string, error) {
+	pageNodes := scrape.FindAll(root, matcher)
+	if len(pageNodes) < 1 {
+		return nil, &URLError{PageUrl: pageUrl, Err: MissingDownloadLinkErr}
+	}
+
+	fileUrls := make([]string, 0, len(pageNodes))
+	seen := make(map[string]bool)
+	for _, node := range pageNodes {
+		fileUrl, err := getFullUrl(pageUrl, scrape.Attr(node, "href"))
+		if err != nil {
+			return nil, &URLError{PageUrl: pageUrl, Err: err}
+		}
+		if !seen[fileUrl] {
+			seen[fileUrl] = true
+			fileUrls = append(fileUrls, fileUrl)
+		}
+	}
+	return fileUrls, nil
+}
+
+// preferredDownloadUrl picks the most likely paper among the candidate download
+// URLs found on the page at pageUrl: the first one ending in .pdf, preferably
+// on the same host as the page.
+func preferredDownloadUrl(pageUrl string, fileUrls []string) string {
+	page, _ := url.Parse(pageUrl)
+	best, bestScore := fileUrls[0], -1
+	for _, fileUrl := range fileUrls {
+		score := 0
+		if u, err := url.Parse(fileUrl); err == nil {
+			if strings.EqualFold(path.Ext(u.Path), ".pdf") {
+				score += 2
 			}
+			if page != nil && u.Host == page.Host {
+				score++
+			}
+		}
+		if score > bestScore {
+			best, bestScore = fileUrl, score
+		}
+	}
+	return best
+}
+
+// findDownloadUrl resolves the download URL of paper to the link matched by
+// matcher in its already parsed source page. On TooManyDownloadLinksErr the
+// returned paper has the most likely of the links.
+func findDownloadUrl(ctx context.Context, paper Paper, root *html.Node, matcher scrape.Matcher) (Paper, error) {
+	pageUrl := paper.SourceURL
+	// grab all paper links
+	fileUrls, err := findDownloadUrls(pageUrl, root, matcher)
+	if err != nil {
+		return paper, err
+	}
+
+	// links behind the JS check are the last resort, other versions of the
+	// paper usually aren't
+	candidates := make([]string, 0, len(fileUrls))
+	for _, fileUrl := range fileUrls {
+		if !strings.Contains(fileUrl, ieeeSecurityHost) {
+			candidates = append(candidates, fileUrl)
+		}
+	}
+	if len(candidates) > 0 && len(candidates) < len(fileUrls) {
+		logger.debugf("skipping %d %s links on %s", len(fileUrls)-len(candidates), ieeeSecurityHost, pageUrl)
+	}
+	if len(candidates) > 0 {
+		fileUrls = candidates
+	}
+
+	fileUrl := preferredDownloadUrl(pageUrl, fileUrls)
+	if len(fileUrls) > 1 && len(candidates) > 0 {
+		paper.DownloadURL = fileUrl
+		return paper, &URLError{PageUrl: pageUrl, DownloadUrl: fileUrl, Err: &TooManyDownloadLinksError{URLs: fileUrls}}
+	}
+
+	if strings.Contains(fileUrl, ieeeSecurityHost) {
+		allVersionsRegex := regexp.MustCompile(`^All [\d]+ versions$`)
+		allVersionsMatcher := func(n *html.Node) bool {
+			if n.DataAtom == atom.A {
+				return allVersionsRegex.MatchString(scrape.Text(n))
+			}
+			return false
+		}
+
+		versionLink, ok := scrape.Find(root, allVersionsMatcher)
+		if !ok {
+			return paper, &URLError{PageUrl: pageUrl, DownloadUrl: fileUrl, Err: NoVersionLinkErr}
+		}
+		versionUrl, err := getFullUrl(pageUrl, scrape.Attr(versionLink, "href"))
+		if err != nil {
+			return paper, &URLError{PageUrl: pageUrl, Err: err}
+		}
+
+		urlMatcher := func(n *html.Node) bool {
+			// must check for nil values
+			if n.DataAtom == atom.A && n.Parent != nil {
+				href := scrape.Attr(n, "href")
+				return strings.HasSuffix(href, ".pdf") && scrape.Attr(n.Parent, "class") == "gs_or_ggsm" && !strings.Contains(href, ieeeSecurityHost)
+			}
+			return false
+		}
+
+		// the paper is still the one found on the original page
+		versions := paper
+		versions.SourceURL = versionUrl
+		resolved, err := getDownloadUrl(ctx, versions, urlMatcher)
+		resolved.SourceURL = pageUrl
+		return resolved, err
+	}
+
+	paper.DownloadURL = fileUrl
+	return paper, nil
+}
+
+// getLinks fetches the page at pageUrl and returns the papers of conf linked
+// from it, like findLinks.
+func getLinks(ctx context.Context, conf Conference, pageUrl string, matcher scrape.Matcher) ([]Paper, error) {
+	root, err := fetchHTML(ctx, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+	return findLinks(conf, pageUrl, root, matcher), nil
+}
+
+// maxPages is how many pages getPaginatedLinks follows at most.
+const maxPages = 100
+
+// getPaginatedLinks collects the papers of conf linked from the page at pageUrl
+// and every following page, like findLinks. Following pages are found through
+// the link matched by nextMatcher. Pages are never visited twice, so pagers
+// that wrap around don't loop forever. Only an error fetching the first page is returned; a
+// later page that fails is logged and the links found so far are kept.
+func getPaginatedLinks(ctx context.Context, conf Conference, pageUrl string, matcher, nextMatcher scrape.Matcher) ([]Paper, error) {
+	links := make([]Paper, 0)
+	visited := make(map[string]bool)
+	for pageUrl != "" && !visited[pageUrl] && len(visited) < maxPages {
+		visited[pageUrl] = true
+		root, err := fetchHTML(ctx, pageUrl)
+		if err != nil {
+			if len(visited) == 1 || ctx.Err() != nil {
+				return nil, err
+			}
+			logger.errorf("stopped following pages: %s", err)
+			break
+		}
+		links = append(links, findLinks(conf, pageUrl, root, matcher)...)
+
+		next, ok := scrape.Find(root, nextMatcher)
+		if !ok {
+			break
+		}
+		if pageUrl, err = getFullUrl(pageUrl, scrape.Attr(next, "href")); err != nil {
+			logger.warnf("not following malformed next page link: %s", err)
+			break
+		}
+		logger.debugf("following next page link: %s", pageUrl)
+	}
+	return links, nil
+}
+
+// nextPageMatcher matches the usual markup of links to a following page: a
+// rel="next" attribute or a Drupal style "pager-next" item.
+func nextPageMatcher(n *html.Node) bool {
+	if n.DataAtom != atom.A {
+		return false
+	}
+	if scrape.Attr(n, "rel") == "next" {
+		return true
+	}
+	return n.Parent != nil && strings.Contains(scrape.Attr(n.Parent, "class"), "pager-next")
+}
+
+// usenixPaperMatcher matches the links to the paper pages of a USENIX
+// technical sessions page.
+func usenixPaperMatcher(n *html.Node) bool {
+	// must check for nil values
+	if n.DataAtom == atom.A && n.Parent != nil && n.Parent.Parent != nil {
+		return strings.Contains(scrape.Attr(n.Parent.Parent, "class"), "node-paper")
+	}
+	return false
+}
+
+// findLinks returns the papers of conf linked by the anchors matched by matcher
+// in the already parsed page at pageUrl, titled by the anchor text. Listings
+// linking a page per paper rather than the PDF need paperPage.
+func findLinks(conf Conference, pageUrl string, root *html.Node, matcher scrape.Matcher) []Paper {
+	// grab all paper links
+	pageNodes := scrape.FindAll(root, matcher)
+	links := make([]Paper, 0)
+	for _, page := range pageNodes {
+		url, err := getFullUrl(pageUrl, scrape.Attr(page, "href"))
+		if err != nil {
+			logger.warnf("skipping malformed link on %s: %s", pageUrl, err)
+			continue
+		}
+		links = append(links, Paper{
+			Title:       strings.TrimSpace(scrape.Text(page)),
+			SourceURL:   pageUrl,
+			DownloadURL: url,
+			Conference:  conf,
+		})
+	}
+
+	return links
+}
+
+// getUsenixPaperDetails fills in the title, authors and abstract of paper from
+// its USENIX paper page. The title from the listing stays if the page has none.
+func getUsenixPaperDetails(root *html.Node, paper Paper) Paper {
+	fieldText := func(class string) string {
+		field, ok := scrape.Find(root, func(n *html.Node) bool {
+			return n.Type == html.ElementNode && strings.Contains(scrape.Attr(n, "class"), class)
+		})
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(scrape.Text(field))
+	}
+
+	if title, ok := scrape.Find(root, scrape.ById("page-title")); ok {
+		if text := strings.TrimSpace(scrape.Text(title)); text != "" {
+			paper.Title = text
+		}
+	}
+	paper.Authors = fieldText("field-name-field-paper-people-text")
+	paper.Abstract = fieldText("field-name-field-paper-description")
+	return paper
+}
+
+// scholarPdfMatcher matches the PDF links next to Google Scholar search results.
+func scholarPdfMatcher(n *html.Node) bool {
+	// must check for nil values
+	if n.DataAtom == atom.A && n.Parent != nil {
+		return strings.HasSuffix(scrape.Attr(n, "href"), ".pdf") && scrape.Attr(n.Parent, "class") == "gs_or_ggsm"
+	}
+	return false
+}
+
+// downloadFromScholar looks up each of the papers on Google Scholar by title
+// and downloads the PDF it links, for conferences that only list paper titles.
+func (r *conferenceRun) downloadFromScholar(ctx context.Context, papers []Paper) {
+	for _, paper := range papers {
+		title := paper.Title
+		if ctx.Err() != nil || r.limitReached() {
+			break
+		}
+		if r.restore(title) {
+			continue
+		}
+		b := new(batch)
+		// Generate google scholar search URL
+		gScholarUrl, err := scholarSearchUrl(title)
+		if err != nil {
+			logger.errorf("%s", err)
+			continue
+		}
+
+		paper.SourceURL = gScholarUrl
+
+		if cached, ok := scholarCache.lookup(title); ok {
+			logger.debugf("%s: %s (cached)", title, cached.DownloadUrl)
+			paper.Authors = cached.Authors
+			paper.DownloadURL = cached.DownloadUrl
+			r.downloadPaper(ctx, paper, b)
+			r.markProcessed(title, b)
+			continue
+		}
+		root, err := fetchHTML(ctx, gScholarUrl)
+		if err != nil {
+			if errors.Is(err, RobotsDisallowedErr) {
+				continue
+			} else if errors.Is(err, ScholarRateLimitedErr) {
+				logger.errorf("Google Scholar is rate limiting us, skipping the remaining papers of %s", r.conf.String())
+				break
+			}
+			logger.errorf("%s", err)
+			continue
+		}
+		paper.Authors = getScholarAuthors(root)
+		resolved, err := findDownloadUrl(ctx, paper, root, scholarPdfMatcher)
+		if err != nil {
+			if errors.Is(err, MissingDownloadLinkErr) || errors.Is(err, NoVersionLinkErr) {
+				logger.warnf("%s", err)
+				r.downloadFromArxiv(ctx, paper, nil)
+				continue
+			} else if errors.Is(err, RobotsDisallowedErr) {
+				continue
+			} else if errors.Is(err, ScholarRateLimitedErr) {
+				logger.errorf("Google Scholar is rate limiting us, skipping the remaining papers of %s", r.conf.String())
+				break
+			} else if errors.Is(err, TooManyDownloadLinksErr) {
+				logger.warnf("%s", err)
+			} else {
+				logger.errorf("%s", err)
+				continue
+			}
+		}
+		logger.debugf("%s: %s", title, resolved.DownloadURL)
+		if err := scholarCache.store(title, scholarResult{DownloadUrl: resolved.DownloadURL, Authors: paper.Authors}); err != nil {
+			logger.errorf("%s", err)
+		}
+		if strings.Contains(resolved.DownloadURL, ieeeSecurityHost) {
+			logger.warnf("skipping download, since %s checks JS for download...annoying: %s", ieeeSecurityHost, resolved.DownloadURL)
+			r.downloadFromArxiv(ctx, paper, nil)
+		} else {
+			r.downloadPaper(ctx, resolved, b)
+			r.markProcessed(title, b)
+		}
+	}
+}
+
+// ndssLayout is one of the ways the NDSS program page has been laid out over
+// the years.
+type ndssLayout struct {
+	name string
+	// matcher finds the paper links on the program page
+	matcher scrape.Matcher
+	// paperPages is set if the links lead to a page per paper with the PDF
+	// linked as "Paper", rather than to the PDF itself
+	paperPages bool
+	// titledLinks is set if the link text is the paper title
+	titledLinks bool
+}
+
+// ndssLayouts are tried in order against the NDSS program page, the first one
+// finding any links is used.
+var ndssLayouts = []ndssLayout{
+	{
+		// 2020 onwards: "More details" buttons leading to paper pages
+		name: "paper details",
+		matcher: func(n *html.Node) bool {
+			return n.DataAtom == atom.A && strings.Contains(scrape.Attr(n, "class"), "paper-link-abs")
+		},
+		paperPages: true,
+	},
+	{
+		// 2018 and 2019: "Paper" links to the PDFs next to each talk
+		name: "paper links",
+		matcher: func(n *html.Node) bool {
+			return n.DataAtom == atom.A && scrape.Text(n) == "Paper"
+		},
+	},
+	{
+		// 2016: titles linking the PDFs
+		name: "titled PDFs",
+		matcher: func(n *html.Node) bool {
+			// must check for nil values
+			if n.DataAtom == atom.A && n.Parent != nil {
+				return n.Parent.DataAtom == atom.H3 && strings.HasSuffix(scrape.Attr(n, "href"), ".pdf")
+			}
+			return false
+		},
+		titledLinks: true,
+	},
+	{
+		// 2014, 2015 and 2017: titles linking paper pages
+		name: "titled paper pages",
+		matcher: func(n *html.Node) bool {
+			// must check for nil values
+			if n.DataAtom == atom.A && n.Parent != nil {
+				return n.Parent.DataAtom == atom.H3
+			}
+			return false
+		},
+		paperPages:  true,
+		titledLinks: true,
+	},
+}
+
+// getNdssPaperTitle returns the heading of an NDSS paper page, or "" if it has
+// none.
+func getNdssPaperTitle(root *html.Node) string {
+	heading, ok := scrape.Find(root, scrape.ByTag(atom.H1))
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(scrape.Text(heading))
+}
+
+// getNdssPaperAbstract returns the abstract on an NDSS paper page, the longest
+// paragraph of its paper data, or "" if there is none.
+func getNdssPaperAbstract(root *html.Node) string {
+	data, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && strings.Contains(scrape.Attr(n, "class"), "paper-data")
+	})
+	if !ok {
+		return ""
+	}
+	abstract := ""
+	for _, paragraph := range scrape.FindAll(data, scrape.ByTag(atom.P)) {
+		if text := strings.TrimSpace(scrape.Text(paragraph)); len(text) > len(abstract) {
+			abstract = text
+		}
+	}
+	return abstract
+}
+
+// minCcsTitleWords is the fewest words a bold line of a CCS accepted papers
+// page needs to be taken for a paper title.
+const minCcsTitleWords = 4
+
+// parserCoverage describes the conferences and years each built-in parser of
+// fetchConference handles, for -list.
+var parserCoverage = []struct {
+	name  string
+	years string
+	notes string
+	// covers reports whether the parser handles the conference
+	covers func(conf Conference) bool
+}{
+	{"USENIX", "all", "paper pages linked from the technical sessions page", anyYear},
+	{"NDSS", "all", "layout detected from the program page: paper details (2020 on), paper links (2018-2019), titled PDFs (2016), titled paper pages (2014, 2015, 2017)", anyYear},
+	{"Oakland", "up to 2019, all from computer.org", "PDFs of the official proceedings listing when the URL is on " + computerOrgHost + ", otherwise titles looked up on Google Scholar", func(conf Conference) bool {
+		return conf.Year <= 2019 || isComputerOrgUrl(conf.URL)
+	}},
+	{"EuroS&P", "all", "titles looked up on Google Scholar", anyYear},
+	{"CCS", "all", "[PDF] links where the page has them (2017), otherwise titles looked up on Google Scholar", anyYear},
+	{"PETS", "all", "PDF links of a PoPETs issue listing", anyYear},
+}
+
+func anyYear(Conference) bool {
+	return true
+}
+
+// parserFor names the parser fetchConference uses for conf, or returns "" if
+// there is none for its name and year.
+func parserFor(conf Conference) string {
+	if conf.Matcher != nil {
+		return "matcher"
+	}
+	for _, parser := range parserCoverage {
+		if parser.name == conf.Name && parser.covers(conf) {
+			return parser.name
+		}
+	}
+	return ""
+}
+
+// printConferences lists the configured conferences and the parser each would
+// be fetched with, without any network requests.
+func printConferences(conferences []Conference) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "conference\tyear\tparser\turl")
+	for _, conf := range conferences {
+		parser := parserFor(conf)
+		if parser == "" {
+			parser = "NO PARSER FOUND"
+		}
+		fmt.Fprintf(table, "%s\t%d\t%s\t%s\n", conf.Name, conf.Year, parser, conf.URL)
+	}
+	table.Flush()
+}
+
+// printParsers lists the built-in parsers and what they cover.
+func printParsers() {
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "conference\tyears\tnotes")
+	for _, parser := range parserCoverage {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", parser.name, parser.years, parser.notes)
+	}
+	fmt.Fprintln(table, "any\tall\tconferences with a matcher in the conferences file")
+	table.Flush()
+}
+
+// fetchConference downloads the papers of a single conference. The returned
+// run is nil if there is no parser for the conference.
+func fetchConference(ctx context.Context, conf Conference) (*conferenceRun, error) {
+	if conf.Matcher != nil {
+		return fetchMatchedConference(ctx, conf)
+	}
+
+	switch conf.Name {
+	case "USENIX":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
 
+		pages, err := getPaginatedLinks(ctx, conf, conf.URL, usenixPaperMatcher, nextPageMatcher)
+		if err != nil {
+			return run, err
+		}
+
+		for _, p := range pages {
+			if ctx.Err() != nil || run.limitReached() {
+				break
+			}
 			// define a matcher
-			matcher := func(n *html.Node) bool {
+			urlMatcher := func(n *html.Node) bool {
 				// must check for nil values
-				if n.DataAtom == atom.A && n.Parent != nil && n.Parent.Parent != nil {
-					return strings.Contains(scrape.Attr(n.Parent.Parent, "class"), "node-paper")
+				if n.DataAtom == atom.A && n.Parent != nil {
+					return scrape.Attr(n.Parent, "class") == "file"
 				}
 				return false
 			}
-			pages, err := getLinks(conf.URL, matcher)
-			if err != nil {
-				log.Fatal(err)
+			page := p.paperPage()
+			if run.restore(page.SourceURL) {
+				continue
 			}
-
-			for _, p := range pages {
-				// define a matcher
-				urlMatcher := func(n *html.Node) bool {
-					// must check for nil values
-					if n.DataAtom == atom.A && n.Parent != nil {
-						return scrape.Attr(n.Parent, "class") == "file"
-					}
-					return false
-				}
-				downloadUrl, err := getDownloadUrl(p, urlMatcher)
-				if err != nil {
-					if err == MissingDownloadLinkErr {
-						continue
-					} else if err == TooManyDownloadLinksErr {
-						log.Println(err)
+			b := new(batch)
+			root, err := fetchHTML(ctx, page.SourceURL)
+			if errors.Is(err, RobotsDisallowedErr) {
+				continue
+			} else if err != nil {
+				logger.errorf("%s", err)
+				continue
+			}
+			paper := getUsenixPaperDetails(root, page)
+			resolved, err := findDownloadUrl(ctx, paper, root, urlMatcher)
+			downloadUrls := []string{resolved.DownloadURL}
+			var tooMany *TooManyDownloadLinksError
+			if err != nil {
+				if errors.Is(err, MissingDownloadLinkErr) {
+					run.downloadFromArxiv(ctx, paper, nil)
+					continue
+				} else if errors.Is(err, RobotsDisallowedErr) {
+					continue
+				} else if errors.As(err, &tooMany) {
+					if config.allLinks {
+						downloadUrls = tooMany.URLs
 					} else {
-						log.Fatal(err)
+						logger.warnf("%s", err)
 					}
+				} else {
+					logger.errorf("%s", err)
+					continue
 				}
-				log.Println(downloadUrl)
-				splitUrl := strings.Split(downloadUrl, "/")
-				filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-				downloadFile(downloadUrl, filepath)
-				time.Sleep(config.fetchTimeout)
-			}
-		case "NDSS":
-			confDirectory, err := createConfDirectory(config.outputDirectory, conf)
-			if err != nil {
-				log.Fatal(err)
 			}
+			for _, downloadUrl := range downloadUrls {
+				logger.debugf("resolved download URL: %s", downloadUrl)
+				paper.DownloadURL = downloadUrl
+				run.downloadPaper(ctx, paper, b)
+			}
+			run.markProcessed(page.SourceURL, b)
+		}
+		return run, nil
+	case "NDSS":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		root, err := fetchHTML(ctx, conf.URL)
+		if err != nil {
+			return run, err
+		}
+		var layout ndssLayout
+		var links []Paper
+		for _, layout = range ndssLayouts {
+			if links = findLinks(conf, conf.URL, root, layout.matcher); len(links) > 0 {
+				break
+			}
+		}
+		if len(links) == 0 {
+			logger.warnf("no parser found for %s", conf.String())
+			return run, nil
+		}
+		logger.infof("%s: program page matches the %s layout", conf.String(), layout.name)
 
-			switch {
-			case conf.Year == 2018 || conf.Year == 2019:
-				matcher := func(n *html.Node) bool {
-					// must check for nil values
-					if n.DataAtom == atom.A {
-						return scrape.Text(n) == "Paper"
-					}
-					return false
+		if !layout.paperPages {
+			for _, link := range links {
+				if ctx.Err() != nil || run.limitReached() {
+					break
 				}
-
-				downloadLinks, err := getLinks(conf.URL, matcher)
-				if err != nil {
-					log.Fatal(err)
+				logger.debugf("found download URL: %s", link.DownloadURL)
+				if !layout.titledLinks {
+					link.Title = ""
 				}
+				run.downloadPaper(ctx, link, nil)
+			}
+			return run, nil
+		}
 
-				for _, link := range downloadLinks {
-					log.Println(link)
-					splitUrl := strings.Split(link, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					downloadFile(link, filepath)
-					time.Sleep(config.fetchTimeout)
+		for _, p := range links {
+			if ctx.Err() != nil || run.limitReached() {
+				break
+			}
+			urlMatcher := func(n *html.Node) bool {
+				// must check for nil values
+				if n.DataAtom == atom.A {
+					return scrape.Text(n) == "Paper"
 				}
-			case conf.Year == 2017 || conf.Year == 2015 || conf.Year == 2014:
-				matcher := func(n *html.Node) bool {
-					// must check for nil values
-					if n.DataAtom == atom.A && n.Parent != nil {
-						return n.Parent.DataAtom == atom.H3
+				return false
+			}
+			paper := p.paperPage()
+			if run.restore(paper.SourceURL) {
+				continue
+			}
+			b := new(batch)
+
+			root, err := fetchHTML(ctx, paper.SourceURL)
+			if errors.Is(err, RobotsDisallowedErr) {
+				continue
+			} else if err != nil {
+				logger.errorf("%s", err)
+				continue
+			}
+			if !layout.titledLinks {
+				paper.Title = getNdssPaperTitle(root)
+			}
+			resolved, err := findDownloadUrl(ctx, paper, root, urlMatcher)
+			downloadUrls := []string{resolved.DownloadURL}
+			var tooMany *TooManyDownloadLinksError
+			if err != nil {
+				if errors.Is(err, MissingDownloadLinkErr) {
+					run.downloadFromArxiv(ctx, paper, nil)
+					continue
+				} else if errors.Is(err, RobotsDisallowedErr) {
+					continue
+				} else if errors.As(err, &tooMany) {
+					if config.allLinks {
+						downloadUrls = tooMany.URLs
+					} else {
+						logger.warnf("%s", err)
 					}
-					return false
+				} else {
+					logger.errorf("%s", err)
+					continue
+				}
+			}
+			paper.Abstract = getNdssPaperAbstract(root)
+			for _, downloadUrl := range downloadUrls {
+				logger.debugf("resolved download URL: %s", downloadUrl)
+				paper.DownloadURL = downloadUrl
+				run.downloadPaper(ctx, paper, b)
+			}
+			run.markProcessed(paper.SourceURL, b)
+		}
+		return run, nil
+	case "Oakland":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case isComputerOrgUrl(conf.URL):
+			if err := run.downloadFromComputerOrg(ctx); err != nil {
+				return run, err
+			}
+		case conf.Year <= 2019 && conf.Year >= 2015:
+			matcher := func(n *html.Node) bool {
+				if n.DataAtom == atom.B && n.Parent != nil {
+					return scrape.Attr(n.Parent, "class") == "list-group-item"
 				}
+				return false
+			}
 
-				pages, err := getLinks(conf.URL, matcher)
-				if err != nil {
-					log.Fatal(err)
+			papers, err := getPapers(ctx, conf, conf.URL, matcher)
+			if err != nil {
+				return run, err
+			}
+			run.downloadFromScholar(ctx, papers)
+		case conf.Year <= 2014:
+			matcher := func(n *html.Node) bool {
+				if n.DataAtom == atom.A && n.Parent != nil && n.Parent.Parent != nil {
+					return scrape.Attr(n.Parent.Parent, "class") == "list-group-item"
 				}
+				return false
+			}
 
-				for _, p := range pages {
-					urlMatcher := func(n *html.Node) bool {
-						// must check for nil values
-						if n.DataAtom == atom.A {
-							return scrape.Text(n) == "Paper"
-						}
-						return false
-					}
+			papers, err := getPapers(ctx, conf, conf.URL, matcher)
+			if err != nil {
+				return run, err
+			}
+			run.downloadFromScholar(ctx, papers)
+		default:
+			logger.warnf("no parser found for %s", conf.String())
+		}
+		return run, nil
+	case "EuroS&P":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
 
-					downloadUrl, err := getDownloadUrl(p, urlMatcher)
-					if err != nil {
-						if err == MissingDownloadLinkErr {
-							continue
-						} else if err == TooManyDownloadLinksErr {
-							log.Println(err)
-						} else {
-							log.Fatal(err)
-						}
-					}
-					log.Println(downloadUrl)
-					splitUrl := strings.Split(downloadUrl, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					downloadFile(downloadUrl, filepath)
-					time.Sleep(config.fetchTimeout)
-				}
-			case conf.Year == 2016:
-				// define a matcher
-				matcher := func(n *html.Node) bool {
-					// must check for nil values
-					if n.DataAtom == atom.A && n.Parent != nil {
-						return n.Parent.DataAtom == atom.H3
-					}
-					return false
+		// the program is laid out like Oakland's, with bold titles in list items
+		matcher := func(n *html.Node) bool {
+			if n.DataAtom == atom.B && n.Parent != nil {
+				return scrape.Attr(n.Parent, "class") == "list-group-item"
+			}
+			return false
+		}
+		papers, err := getPapers(ctx, conf, conf.URL, matcher)
+		if err != nil {
+			return run, err
+		}
+		run.downloadFromScholar(ctx, papers)
+		return run, nil
+	case "CCS":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
+		matcher := func(n *html.Node) bool {
+			// must check for nil values
+			if n.DataAtom == atom.A {
+				return scrape.Text(n) == "[PDF]"
+			}
+			return false
+		}
+
+		downloadLinks, err := getLinks(ctx, conf, conf.URL, matcher)
+		if err != nil {
+			return run, err
+		}
+		if len(downloadLinks) > 0 {
+			for _, link := range downloadLinks {
+				if ctx.Err() != nil || run.limitReached() {
+					break
 				}
+				logger.debugf("found download URL: %s", link.DownloadURL)
+				// the links only say [PDF]
+				link.Title = ""
+				run.downloadPaper(ctx, link, nil)
+			}
+			return run, nil
+		}
 
-				downloadLinks, err := getLinks(conf.URL, matcher)
-				if err != nil {
-					log.Fatal(err)
+		// Most years only list accepted papers by title, in bold
+		titleMatcher := func(n *html.Node) bool {
+			if (n.DataAtom == atom.B || n.DataAtom == atom.Strong) && n.Parent != nil {
+				switch n.Parent.DataAtom {
+				case atom.Li, atom.P, atom.Td:
+					// skip session names and other short headings
+					return len(strings.Fields(scrape.Text(n))) >= minCcsTitleWords
 				}
+			}
+			return false
+		}
+		papers, err := getPapers(ctx, conf, conf.URL, titleMatcher)
+		if err != nil {
+			return run, err
+		}
+		if len(papers) == 0 {
+			logger.warnf("no parser found for %s", conf.String())
+			return run, nil
+		}
+		run.downloadFromScholar(ctx, papers)
+		return run, nil
+
+	case "PETS":
+		run, err := newConferenceRun(conf)
+		if err != nil {
+			return nil, err
+		}
 
-				for _, link := range downloadLinks {
-					log.Println(link)
-					splitUrl := strings.Split(link, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					downloadFile(link, filepath)
-					time.Sleep(config.fetchTimeout)
+		// every article of the issue is a list item linking its PDF
+		matcher := func(n *html.Node) bool {
+			if n.DataAtom != atom.A || !strings.HasSuffix(scrape.Attr(n, "href"), ".pdf") {
+				return false
+			}
+			for p := n.Parent; p != nil; p = p.Parent {
+				if p.DataAtom == atom.Li {
+					return true
 				}
-			default:
-				log.Printf("no parser found for %s", conf.String())
 			}
-		case "Oakland":
-			confDirectory, err := createConfDirectory(config.outputDirectory, conf)
+			return false
+		}
+		root, err := fetchHTML(ctx, conf.URL)
+		if err != nil {
+			return run, err
+		}
+		// a year of PoPETs has several issues, which the year page either
+		// lists in full or links to
+		issueUrls := []string{conf.URL}
+		for _, link := range scrape.FindAll(root, petsIssueMatcher) {
+			issueUrl, err := getFullUrl(conf.URL, scrape.Attr(link, "href"))
 			if err != nil {
-				log.Fatal(err)
+				logger.warnf("skipping malformed link on %s: %s", conf.URL, err)
+				continue
 			}
-			switch {
-			case conf.Year <= 2019 && conf.Year >= 2015:
-				matcher := func(n *html.Node) bool {
-					if n.DataAtom == atom.B && n.Parent != nil {
-						return scrape.Attr(n.Parent, "class") == "list-group-item"
-					}
-					return false
-				}
+			// anchors into the year page itself are covered by it
+			if strings.SplitN(issueUrl, "#", 2)[0] != conf.URL {
+				issueUrls = append(issueUrls, issueUrl)
+			}
+		}
 
-				titles, err := getPaperTitles(conf.URL, matcher)
-				if err != nil {
-					log.Fatal(err)
+		for _, issueUrl := range issueUrls {
+			if ctx.Err() != nil || run.limitReached() {
+				break
+			}
+			issueRoot := root
+			if issueUrl != conf.URL {
+				logger.debugf("%s: %s", conf.String(), issueUrl)
+				if issueRoot, err = fetchHTML(ctx, issueUrl); errors.Is(err, RobotsDisallowedErr) {
+					continue
+				} else if err != nil {
+					logger.errorf("%s", err)
+					continue
 				}
-				for _, title := range titles {
-					// Generate google scholar search URL
-					gScholarSearchTemplate := "https://scholar.google.com/scholar?q="
-					queryString := strings.Replace(title, " ", "+", -1)
-					gScholarUrl, err := url.Parse(gScholarSearchTemplate + queryString)
-					if err != nil {
-						log.Fatal(err)
-					}
-
-					urlMatcher := func(n *html.Node) bool {
-						// must check for nil values
-						if n.DataAtom == atom.A && n.Parent != nil {
-							href := scrape.Attr(n, "href")
-							return strings.HasSuffix(href, ".pdf") && scrape.Attr(n.Parent, "class") == "gs_or_ggsm"
-						}
-						return false
-					}
-
-					downloadUrl, err := getDownloadUrl(gScholarUrl.String(), urlMatcher)
-					if err != nil {
-						if err == MissingDownloadLinkErr {
-							log.Printf("missing download link for: %s\n", gScholarUrl.String())
-							time.Sleep(config.fetchTimeout)
-							continue
-						} else if err == TooManyDownloadLinksErr {
-							log.Println(err)
-						} else {
-							log.Fatal(err)
-						}
-					}
-					log.Printf("%s: %s", title, downloadUrl)
-					splitUrl := strings.Split(downloadUrl, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					if strings.Contains(downloadUrl, "www.ieee-security.org") {
-						log.Println("skipping download, since www.ieee-security.org checks JS for download...annoying")
-					} else {
-						downloadFile(downloadUrl, filepath)
-					}
-					time.Sleep(config.fetchTimeout)
+			}
+			for _, link := range findLinks(conf, issueUrl, issueRoot, matcher) {
+				if ctx.Err() != nil || run.limitReached() {
+					break
 				}
-			case conf.Year <= 2014:
-				matcher := func(n *html.Node) bool {
-					if n.DataAtom == atom.A && n.Parent != nil && n.Parent.Parent != nil {
-						return scrape.Attr(n.Parent.Parent, "class") == "list-group-item"
-					}
-					return false
+				logger.debugf("found download URL: %s", link.DownloadURL)
+				// some issues link the PDF as just "PDF" next to the title
+				if strings.EqualFold(link.Title, "pdf") {
+					link.Title = ""
 				}
+				run.downloadPaper(ctx, link, nil)
+			}
+		}
+		return run, nil
 
-				titles, err := getPaperTitles(conf.URL, matcher)
-				if err != nil {
-					log.Fatal(err)
-				}
-				for _, title := range titles {
-					// Generate google scholar search URL
-					gScholarSearchTemplate := "https://scholar.google.com/scholar?q="
-					queryString := strings.Replace(title, " ", "+", -1)
-					gScholarUrl, err := url.Parse(gScholarSearchTemplate + queryString)
-					if err != nil {
-						log.Fatal(err)
-					}
+	default:
+		logger.warnf("no parser found for %s", conf.String())
+	}
+	return nil, nil
+}
 
-					urlMatcher := func(n *html.Node) bool {
-						// must check for nil values
-						if n.DataAtom == atom.A && n.Parent != nil {
-							return strings.HasSuffix(scrape.Attr(n, "href"), ".pdf") && scrape.Attr(n.Parent, "class") == "gs_or_ggsm"
-						}
-						return false
-					}
+// petsIssueRegex matches the links from a PoPETs year page to its issues.
+var petsIssueRegex = regexp.MustCompile(`^Issue \d+$`)
 
-					downloadUrl, err := getDownloadUrl(gScholarUrl.String(), urlMatcher)
-					if err != nil {
-						if err == MissingDownloadLinkErr {
-							continue
-						} else if err == TooManyDownloadLinksErr {
-							log.Println(err)
-						} else {
-							log.Fatal(err)
-						}
-					}
+func petsIssueMatcher(n *html.Node) bool {
+	return n.DataAtom == atom.A && petsIssueRegex.MatchString(strings.TrimSpace(scrape.Text(n)))
+}
 
-					log.Printf("%s: %s", title, downloadUrl)
-					splitUrl := strings.Split(downloadUrl, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					if strings.Contains(downloadUrl, "www.ieee-security.org") {
-						log.Println("skipping download, since www.ieee-security.org checks JS for download...annoying")
-					} else {
-						downloadFile(downloadUrl, filepath)
-					}
-					time.Sleep(config.fetchTimeout)
-				}
-			default:
-				log.Printf("no parser found for %s", conf.String())
+// printSummary logs how far each conference got.
+func printSummary(runs []*conferenceRun, elapsed time.Duration) {
+	// the table would break up machine readable output
+	if logger.json {
+		for _, run := range runs {
+			logger.infof("%s: attempted %d, downloaded %d, skipped %d, failed %d, duplicates %d, in index %d, %d bytes", run.conf.String(), run.resolved, run.downloaded, run.skipped, run.failed, run.duplicates, len(run.index), run.bytes)
+		}
+		logger.infof("finished in %s", elapsed.Round(time.Second))
+		return
+	}
+
+	var total conferenceRun
+	indexed := 0
+	table := tabwriter.NewWriter(log.Writer(), 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "conference\tattempted\tdownloaded\tskipped\tfailed\tduplicates\tin index\tbytes\t")
+	for _, run := range runs {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n", run.conf.String(), run.resolved, run.downloaded, run.skipped, run.failed, run.duplicates, len(run.index), formatBytes(run.bytes))
+		total.resolved += run.resolved
+		total.downloaded += run.downloaded
+		total.skipped += run.skipped
+		total.failed += run.failed
+		total.duplicates += run.duplicates
+		indexed += len(run.index)
+		total.bytes += run.bytes
+	}
+	fmt.Fprintf(table, "total\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t\n", total.resolved, total.downloaded, total.skipped, total.failed, total.duplicates, indexed, formatBytes(total.bytes))
+	table.Flush()
+	log.Printf("finished in %s", elapsed.Round(time.Second))
+}
+
+// formatBytes formats a byte count for humans, e.g. 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// newTlsConfig returns the TLS configuration for -ca-file and
+// -insecure-skip-verify.
+func newTlsConfig(caFile string, insecure bool) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in -ca-file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if insecure {
+		logger.warnf("not verifying TLS certificates, connections can be intercepted")
+		tlsConfig.InsecureSkipVerify = true
+	}
+	return tlsConfig, nil
+}
+
+// Pre-main bind flags to variables
+func init() {
+	flag.DurationVar(&config.fetchTimeout, "timeout", 2*time.Second, "delay between requests to the same host")
+	flag.Float64Var(&config.rpsPerHost, "rps-per-host", 0, "requests per second allowed to each host, overrides -timeout when set")
+	flag.IntVar(&config.burstPerHost, "burst-per-host", 1, "number of requests that may be sent to a host at once before -rps-per-host applies")
+	flag.IntVar(&config.concurrency, "concurrency", 1, "number of papers downloaded at once")
+	flag.IntVar(&config.perHost, "per-host", 0, "number of papers downloaded at once from a single host, within -concurrency (default no cap of its own)")
+	flag.Var(&config.maxBandwidth, "max-bandwidth", "cap the combined download throughput, e.g. 2MB/s (default unlimited)")
+	flag.Var(&config.minFreeSpace, "min-free-space", "skip downloads that would leave less than this much free space in the output directory, e.g. 500MB (default no check)")
+	flag.StringVar(&config.conferencesFile, "config", "conferences.json", "JSON or YAML file listing conferences, - for stdin or an http(s) URL to fetch it from")
+	flag.StringVar(&config.outputDirectory, "output-dir", "papers", "output directory for storing papers")
+	flag.StringVar(&config.nameBy, "name-by", "url", "how to name downloaded papers: url (basename of the download URL) or title")
+	flag.StringVar(&config.nameTemplate, "name-template", "", "name downloaded papers after a template with {conf}, {year}, {title} and {index} placeholders, overriding -name-by")
+	flag.StringVar(&config.outputLayout, "layout", "conf-year", "where papers are stored: conf-year (<name>/<year>/), year-conf (<year>/<name>/) or flat (the output directory, prefixed by conference and year)")
+	flag.StringVar(&config.outputLayout, "output-layout", "conf-year", "same as -layout, with nested for conf-year")
+	flag.BoolVar(&config.flat, "flat", false, "same as -layout flat")
+	flag.BoolVar(&config.bibtex, "bibtex", false, "write a references.bib with an entry per paper for each conference, and one for all of them in the output directory")
+	flag.BoolVar(&config.saveAbstracts, "save-abstracts", false, "write the abstract of papers whose parser finds one next to the PDF, as <name>.abstract.txt")
+	flag.Var(&config.only, "only", "only fetch the given conferences, as Name or Name:Year (repeatable or comma-separated)")
+	flag.DurationVar(&config.deadline, "deadline", 0, "stop the whole run after this long, keeping what was downloaded so far, 0 for no limit")
+	flag.BoolVar(&config.dryRun, "dry-run", false, "resolve and print download URLs without downloading anything")
+	flag.StringVar(&config.reportCsv, "report-csv", "", "write a CSV file with a row per attempted download and its outcome")
+	flag.StringVar(&config.metadataOnly, "metadata-only", "", "resolve papers without downloading them and write their titles, page and PDF URLs to this JSON or .csv file")
+	flag.BoolVar(&config.verbose, "verbose", false, "log debug output such as resolved URLs")
+	flag.BoolVar(&config.quiet, "quiet", false, "only log warnings and errors")
+	flag.StringVar(&config.logLevel, "log-level", "", "lowest level to log: debug, info, warn or error, overrides -verbose and -quiet")
+	flag.BoolVar(&config.logJson, "log-json", false, "log one JSON object per line instead of text")
+	flag.BoolVar(&config.jsonEvents, "json-events", false, "write progress events as JSON lines to stderr, moving the log to stdout")
+	flag.BoolVar(&config.ignoreRobots, "ignore-robots", false, "fetch pages even if the host's robots.txt disallows it")
+	flag.Var(&config.names, "conference", "only fetch conferences with the given names (repeatable or comma-separated)")
+	flag.Var(&config.years, "year", "only fetch conferences from the given years (repeatable or comma-separated)")
+	flag.IntVar(&config.sinceYear, "since-year", 0, "only fetch conferences from this year on")
+	flag.IntVar(&config.untilYear, "until-year", 0, "only fetch conferences up to this year")
+	flag.IntVar(&config.maxPapers, "max-papers", 0, "stop each conference after downloading this many papers, 0 for no limit")
+	flag.IntVar(&config.limit, "limit", 0, "stop each conference after resolving this many papers, even in dry-run mode, 0 for no limit")
+	flag.BoolVar(&config.list, "list", false, "list the built-in parsers and the configured conferences with the parser each would use, and exit")
+	flag.BoolVar(&config.verify, "verify", false, "check downloaded papers against their recorded checksums and for truncation instead of fetching")
+	flag.BoolVar(&config.repair, "repair", false, "with -verify, download missing or corrupt papers again (same as -overwrite)")
+	flag.BoolVar(&config.ifModifiedSince, "if-modified-since", false, "skip conferences whose page the server reports unchanged since the last complete run")
+	flag.BoolVar(&config.resume, "resume", false, "skip conferences that already have an index from a previous run")
+	flag.BoolVar(&config.restart, "restart", false, "forget the paper pages and titles processed by previous runs, processing them all again")
+	flag.BoolVar(&config.force, "force", false, "with -resume, fetch conferences again even if they already have an index")
+	flag.BoolVar(&config.overwrite, "overwrite", false, "download papers again even if the file already exists")
+	flag.BoolVar(&config.update, "update", false, "download existing papers again if the server has a different or newer version, checked with a HEAD request")
+	flag.BoolVar(&config.preflight, "preflight", false, "with -overwrite, ask the server with a HEAD request first and keep files that look unchanged")
+	flag.BoolVar(&config.waybackFallback, "wayback-fallback", false, "download the latest Wayback Machine snapshot of papers whose download URL is 404 Not Found")
+	flag.BoolVar(&config.arxivFallback, "arxiv-fallback", false, "look papers up on arXiv by title when no download link is found or the download fails")
+	flag.StringVar(&config.proxy, "proxy", "", "HTTP, HTTPS or SOCKS5 proxy URL for all requests, instead of HTTP_PROXY/HTTPS_PROXY")
+	flag.BoolVar(&config.insecure, "insecure-skip-verify", false, "don't verify TLS certificates, for sites with expired or self-signed ones")
+	flag.StringVar(&config.authUser, "auth-user", "", "user name for basic auth with the -auth-host hosts")
+	flag.StringVar(&config.authPass, "auth-pass", "", "password for basic auth with the -auth-host hosts")
+	flag.StringVar(&config.authHeader, "auth-header", "", "Authorization header value for the -auth-host hosts, e.g. \"Bearer <token>\"")
+	flag.Var(&config.authHosts, "auth-host", "host to send the -auth-* credentials to, including its subdomains (repeatable or comma-separated)")
+	flag.StringVar(&config.caFile, "ca-file", "", "PEM file of CA certificates to trust in addition to the system ones")
+	flag.Int64Var(&config.minSize, "min-size", 10*1024, "fail downloads smaller than this many bytes instead of keeping them")
+	flag.IntVar(&config.maxRedirects, "max-redirects", 10, "how many redirects to follow per request")
+	flag.DurationVar(&config.scholarDelay, "scholar-delay", 10*time.Second, "delay between requests to Google Scholar")
+	flag.DurationVar(&config.scholarBackoff, "scholar-backoff", time.Minute, "how long to wait before retrying when Google Scholar rate limits us, doubled on every retry")
+	flag.IntVar(&config.scholarRetries, "scholar-retries", 3, "how often to retry when Google Scholar rate limits us before giving up on it, 0 to give up right away")
+	flag.StringVar(&config.scholarUrl, "scholar-url", "https://scholar.google.com/scholar", "Google Scholar search URL, for using another domain or a mirror")
+	flag.BoolVar(&config.refreshCache, "refresh-cache", false, "look papers up on Google Scholar again instead of using the URLs cached by previous runs")
+	flag.BoolVar(&config.cache, "cache", false, "keep fetched HTML pages on disk and reuse them while they are fresh")
+	flag.StringVar(&config.cacheDirectory, "cache-dir", ".sec-fetch-cache", "directory for -cache")
+	flag.DurationVar(&config.cacheTtl, "cache-ttl", 24*time.Hour, "how long pages cached by -cache stay fresh")
+	flag.BoolVar(&config.allLinks, "all-links", false, "download every PDF linked from a paper page instead of only the first")
+}
+
+// configure parses the command line into config and sets up logging, the
+// HTTP client and the output directory accordingly.
+func configure() {
+	// "verify" and "list" are accepted as subcommands for -verify and -list,
+	// "resolve" and "clean" take flags of their own
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "verify" {
+		config.verify = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "list" {
+		config.list = true
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "resolve" {
+		config.resolve = true
+		config.resolveArgs = args[1:]
+		args = nil
+	} else if len(args) > 0 && args[0] == "clean" {
+		config.clean = true
+		config.cleanArgs = args[1:]
+		args = nil
+	}
+	flag.CommandLine.Parse(args)
+
+	logger.json = config.logJson
+	if config.sinceYear > 0 && config.untilYear > 0 && config.sinceYear > config.untilYear {
+		logger.fatalf("-since-year %d is after -until-year %d, no conference can match", config.sinceYear, config.untilYear)
+	}
+	if config.metadataOnly != "" {
+		// nothing is downloaded, so nothing but the metadata is written either
+		config.dryRun = true
+	}
+	if config.jsonEvents {
+		// keep stderr for the event stream
+		log.SetOutput(os.Stdout)
+	}
+	switch {
+	case config.verbose && config.quiet:
+		logger.fatalf("-verbose and -quiet are mutually exclusive")
+	case config.logLevel != "":
+		level, ok := parseLogLevel(config.logLevel)
+		if !ok {
+			logger.fatalf("invalid -log-level value: %s", config.logLevel)
+		}
+		logger.level = level
+	case config.verbose:
+		logger.level = debugLevel
+	case config.quiet:
+		logger.level = warnLevel
+	}
+
+	for _, filter := range config.only {
+		if _, year := splitFilter(filter); year != "" {
+			if _, err := strconv.Atoi(year); err != nil {
+				logger.fatalf("invalid year in -only value: %s", filter)
+			}
+		}
+	}
+	for _, year := range config.years {
+		if _, err := strconv.Atoi(year); err != nil {
+			logger.fatalf("invalid -year value: %s", year)
+		}
+	}
+
+	if config.flat {
+		config.outputLayout = "flat"
+	}
+	switch config.outputLayout {
+	case "nested":
+		config.outputLayout = "conf-year"
+	case "conf-year", "year-conf":
+	case "flat":
+		config.flat = true
+	default:
+		logger.fatalf("invalid -layout value: %s", config.outputLayout)
+	}
+	if config.nameBy != "url" && config.nameBy != "title" {
+		logger.fatalf("invalid -name-by value: %s", config.nameBy)
+	}
+	for _, match := range nameTemplatePlaceholder.FindAllStringSubmatch(config.nameTemplate, -1) {
+		switch match[1] {
+		case "conf", "year", "title", "index":
+		default:
+			logger.fatalf("unknown placeholder in -name-template: %s", match[0])
+		}
+	}
+	if strings.Contains(config.nameTemplate, "/") {
+		logger.fatalf("-name-template must not contain /")
+	}
+
+	interval := config.fetchTimeout
+	if config.rpsPerHost > 0 {
+		interval = time.Duration(float64(time.Second) / config.rpsPerHost)
+	}
+	throttle = newHostThrottle(interval, config.burstPerHost)
+	if config.concurrency < 1 || config.perHost < 0 {
+		logger.fatalf("-concurrency must be at least 1 and -per-host must not be negative")
+	}
+	if config.concurrency > 1 {
+		pool = newDownloadPool(config.concurrency, config.perHost)
+	}
+	if config.maxBandwidth > 0 {
+		bandwidth = &bandwidthLimiter{bytesPerSec: int64(config.maxBandwidth)}
+	}
+
+	if u, err := url.Parse(config.scholarUrl); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		logger.fatalf("invalid -scholar-url value: %s", config.scholarUrl)
+	}
+
+	// the default transport already honors HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.proxy != "" {
+		proxyUrl, err := url.Parse(config.proxy)
+		if err != nil {
+			logger.fatalf("invalid -proxy value: %s", err)
+		}
+		switch proxyUrl.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			logger.fatalf("unsupported -proxy scheme %q, use http, https or socks5", proxyUrl.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+		logger.debugf("sending all requests through proxy %s", proxyUrl.Redacted())
+	}
+	if (config.authUser != "" || config.authPass != "" || config.authHeader != "") && len(config.authHosts) == 0 {
+		logger.fatalf("-auth-user, -auth-pass and -auth-header need -auth-host to limit where credentials are sent")
+	}
+	if config.authHeader != "" && config.authUser != "" {
+		logger.fatalf("-auth-header and -auth-user are mutually exclusive")
+	}
+	if config.insecure || config.caFile != "" {
+		tlsConfig, err := newTlsConfig(config.caFile, config.insecure)
+		if err != nil {
+			logger.fatalf("%s", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	httpClient.Transport = transport
+	// landing pages may set a session cookie the PDF links need
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		logger.fatalf("%s", err)
+	}
+	cookieJar = jar
+	httpClient.Jar = cookieJar
+	scholarThrottle = newHostThrottle(config.scholarDelay, 1)
+
+	if config.dryRun {
+		return
+	}
+
+	// create output directory, MkdirAll is fine with it existing already
+	if err := os.MkdirAll(config.outputDirectory, os.ModePerm); err != nil {
+		logger.fatalf("%s", err)
+	}
+}
+
+func main() {
+	configure()
+	if config.resolve {
+		os.Exit(runResolve(config.resolveArgs))
+	}
+	if config.clean {
+		os.Exit(runClean(config.cleanArgs))
+	}
+	if config.list {
+		printParsers()
+		conferences, err := loadConferences(config.conferencesFile)
+		if err != nil {
+			logger.fatalf("%s", err)
+		}
+		fmt.Println()
+		printConferences(selectConferences(conferences))
+		return
+	}
+
+	conferences, err := loadConferences(config.conferencesFile)
+	if err != nil {
+		logger.fatalf("%s", err)
+	}
+	config.conferences = selectConferences(conferences)
+	if len(config.conferences) == 0 {
+		logger.fatalf("no conferences in %s match the given filters, available conferences are:%s", config.conferencesFile, describeConferences(conferences))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if config.deadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.deadline)
+		defer cancel()
+	}
+
+	if config.verify {
+		failed := 0
+		for _, conf := range config.conferences {
+			n, err := verifyConference(withConference(ctx, conf), conf)
+			if err != nil {
+				logger.fatalf("%s", err)
 			}
-		case "CCS":
-			confDirectory, err := createConfDirectory(config.outputDirectory, conf)
+			failed += n
+		}
+		if failed > 0 {
+			logger.exitf(exitFailures, "%d papers failed verification", failed)
+		}
+		return
+	}
+
+	cache, err := loadScholarCache(config.outputDirectory)
+	if err != nil {
+		logger.fatalf("%s", err)
+	}
+	scholarCache = cache
+	if config.restart && !config.dryRun {
+		if err := os.Remove(path.Join(config.outputDirectory, stateFilename)); err != nil && !os.IsNotExist(err) {
+			logger.fatalf("%s", err)
+		}
+	}
+	if state, err = loadState(config.outputDirectory); err != nil {
+		logger.fatalf("%s", err)
+	}
+	if downloadValidators, err = loadDownloadValidators(config.outputDirectory); err != nil {
+		logger.fatalf("%s", err)
+	}
+	if config.restart {
+		state.conferences = make(map[string]map[string][]IndexEntry)
+	}
+	validators, err := loadPageValidators(config.outputDirectory)
+	if err != nil {
+		logger.fatalf("%s", err)
+	}
+
+	start := time.Now()
+	runs := make([]*conferenceRun, 0)
+	failedConferences := 0
+	for _, conf := range config.conferences {
+		if config.resume && !config.force {
+			run, err := resumeConference(conf)
 			if err != nil {
-				log.Fatal(err)
-			}
-			switch {
-			case conf.Year == 2017:
-				matcher := func(n *html.Node) bool {
-					// must check for nil values
-					if n.DataAtom == atom.A {
-						return scrape.Text(n) == "[PDF]"
-					}
-					return false
-				}
+				logger.fatalf("%s", err)
+			}
+			if run != nil {
+				logger.infof("skipping %s, already fetched by a previous run", conf.String())
+				runs = append(runs, run)
+				continue
+			}
+		}
 
-				downloadLinks, err := getLinks(conf.URL, matcher)
+		var validator pageValidator
+		if config.ifModifiedSince {
+			changed, current, err := validators.changed(withConference(ctx, conf), conf.URL)
+			if err != nil {
+				logger.warnf("could not check whether %s changed: %s", conf.URL, err)
+			}
+			if !changed {
+				// only a completely fetched conference can be skipped
+				run, err := resumeConference(conf)
 				if err != nil {
-					log.Fatal(err)
+					logger.fatalf("%s", err)
+				}
+				if run != nil {
+					logger.infof("skipping %s, its page is unchanged since the last run", conf.String())
+					runs = append(runs, run)
+					continue
 				}
+			}
+			validator = current
+		}
 
-				for _, link := range downloadLinks {
-					log.Println(link)
-					splitUrl := strings.Split(link, "/")
-					filepath := path.Join(confDirectory, splitUrl[len(splitUrl)-1])
-					downloadFile(link, filepath)
-					time.Sleep(config.fetchTimeout)
+		emitEvent(Event{Event: conferenceStartedEvent, Conference: conf.String(), PageUrl: conf.URL})
+		run, err := fetchConference(withConference(ctx, conf), conf)
+		if run != nil {
+			run.wait()
+			runs = append(runs, run)
+			if run.duplicates > 0 {
+				logger.infof("%s: collapsed %d duplicate download URLs", conf.String(), run.duplicates)
+			}
+			// a conference cut short by an error, an interrupt, -limit or
+			// -max-papers must be fetched again by the next run
+			complete := ctx.Err() == nil && err == nil && !run.limitReached()
+			if err := run.save(complete); err != nil {
+				logger.fatalf("%s", err)
+			}
+			if config.ifModifiedSince && !config.dryRun && complete {
+				if err := validators.update(conf.URL, validator); err != nil {
+					logger.fatalf("%s", err)
 				}
-			default:
-				log.Printf("no parser found for %s", conf.String())
 			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		// one conference page failing must not cost the others
+		if err != nil {
+			logger.errorf("%s: %s", conf.String(), err)
+			failedConferences++
+		}
+	}
 
-		default:
-			log.Printf("no parser found for %s", conf.String())
+	printSummary(runs, time.Since(start))
+	if config.reportCsv != "" {
+		if err := writeReportCsv(config.reportCsv); err != nil {
+			logger.fatalf("%s", err)
+		}
+	}
+	if config.metadataOnly != "" {
+		if err := writeMetadata(config.metadataOnly); err != nil {
+			logger.fatalf("%s", err)
 		}
+		logger.infof("wrote %d papers to %s", len(metadata), config.metadataOnly)
+	}
+	if !config.dryRun {
+		if err := writeManifest(config.outputDirectory, runs); err != nil {
+			logger.fatalf("%s", err)
+		}
+		if config.bibtex {
+			if err := writeBibtexFile(config.outputDirectory, runs); err != nil {
+				logger.fatalf("%s", err)
+			}
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.exitf(exitIncomplete, "-deadline of %s reached, stopping early with %d of %d conferences started", config.deadline, len(runs), len(config.conferences))
+	} else if ctx.Err() != nil {
+		logger.exitf(exitIncomplete, "interrupted, stopping early")
+	}
+	failed := 0
+	for _, run := range runs {
+		failed += run.failed
+	}
+	// errors logged while resolving papers count as well as failed downloads
+	if failed > 0 || failedConferences > 0 || logger.errors > 0 {
+		logger.exitf(exitFailures, "finished with %d failed downloads, %d failed conferences, %d errors logged in total", failed, failedConferences, logger.errors)
 	}
 }
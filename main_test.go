@@ -0,0 +1,564 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/yhat/scrape"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newTestServer serves the files in testdata and sets the package up to fetch
+// from it without robots.txt checks or delays between requests.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	t.Cleanup(server.Close)
+	config.ignoreRobots = true
+	throttle = newHostThrottle(0, 1)
+	scholarThrottle = newHostThrottle(0, 1)
+	return server
+}
+
+// fakeFetcher answers requests with the testdata file named by the request
+// path, without any network access.
+type fakeFetcher struct {
+	// paths requested, in order
+	requested []string
+}
+
+func (f *fakeFetcher) Do(req *http.Request) (*http.Response, error) {
+	f.requested = append(f.requested, req.URL.Path)
+	resp := &http.Response{
+		Request: req,
+		Header:  make(http.Header),
+	}
+	page, err := ioutil.ReadFile(path.Join("testdata", req.URL.Path))
+	if err != nil {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = ioutil.NopCloser(strings.NewReader("not found"))
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
+	resp.ContentLength = int64(len(page))
+	resp.Body = ioutil.NopCloser(bytes.NewReader(page))
+	return resp, nil
+}
+
+// useFakeFetcher sends the package's requests to a fakeFetcher for the rest
+// of the test.
+func useFakeFetcher(t *testing.T) *fakeFetcher {
+	t.Helper()
+	fake := &fakeFetcher{}
+	fetcher = fake
+	t.Cleanup(func() { fetcher = httpClient })
+	config.ignoreRobots = true
+	throttle = newHostThrottle(0, 1)
+	scholarThrottle = newHostThrottle(0, 1)
+	return fake
+}
+
+func TestGetFullUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseUrl string
+		linkUrl string
+		want    string
+		wantErr bool
+	}{
+		{"absolute", "https://www.usenix.org/conference/usenixsecurity20", "https://www.usenix.org/system/files/sec20-paper.pdf", "https://www.usenix.org/system/files/sec20-paper.pdf", false},
+		{"absolute on another host", "https://www.usenix.org/conference/", "http://example.com/x.pdf", "http://example.com/x.pdf", false},
+		{"root-relative", "https://www.usenix.org/conference/usenixsecurity20/technical-sessions", "/system/files/sec20-paper.pdf", "https://www.usenix.org/system/files/sec20-paper.pdf", false},
+		{"document-relative", "https://www.ndss-symposium.org/ndss2020/accepted-papers/", "paper.pdf", "https://www.ndss-symposium.org/ndss2020/accepted-papers/paper.pdf", false},
+		{"parent directory", "https://www.ndss-symposium.org/ndss2020/accepted-papers/", "../x.pdf", "https://www.ndss-symposium.org/ndss2020/x.pdf", false},
+		{"scheme-relative", "https://www.ieee-security.org/TC/SP2020/program.html", "//host/x.pdf", "https://host/x.pdf", false},
+		{"query only", "https://scholar.google.com/scholar?q=a", "?q=b", "https://scholar.google.com/scholar?q=b", false},
+		{"malformed link", "https://www.usenix.org/", "http://[::1", "", true},
+		{"malformed escape", "https://www.usenix.org/", "/files/%zz.pdf", "", true},
+		{"malformed base", "http://[::1", "/x.pdf", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := getFullUrl(test.baseUrl, test.linkUrl)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("getFullUrl(%q, %q) = %q, want an error", test.baseUrl, test.linkUrl, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getFullUrl(%q, %q) returned error: %s", test.baseUrl, test.linkUrl, err)
+			}
+			if got != test.want {
+				t.Errorf("getFullUrl(%q, %q) = %q, want %q", test.baseUrl, test.linkUrl, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSlugify(t *testing.T) {
+	if got := slugify("Fast Things: Considered Harmful?"); got != "fast-things-considered-harmful" {
+		t.Errorf("slugify = %q, want %q", got, "fast-things-considered-harmful")
+	}
+	for _, title := range []string{
+		strings.Repeat("Long Titles ", 20),
+		strings.Repeat("Über Sicherheit ", 20),
+		strings.Repeat("安全", 60),
+	} {
+		slug := slugify(title)
+		if len(slug) > maxSlugLength {
+			t.Errorf("slugify(%q) is %d bytes long, want at most %d", title, len(slug), maxSlugLength)
+		}
+		if !utf8.ValidString(slug) {
+			t.Errorf("slugify(%q) = %q, cut in the middle of a character", title, slug)
+		}
+	}
+}
+
+func TestGetDownloadUrl(t *testing.T) {
+	server := newTestServer(t)
+	ctx := context.Background()
+
+	t.Run("single match", func(t *testing.T) {
+		paper, err := getDownloadUrl(ctx, Paper{SourceURL: server.URL + "/scholar-single.html"}, scholarPdfMatcher)
+		if err != nil {
+			t.Fatalf("getDownloadUrl returned error: %s", err)
+		}
+		if want := server.URL + "/papers/sec20-fast.pdf"; paper.DownloadURL != want {
+			t.Errorf("getDownloadUrl = %q, want %q", paper.DownloadURL, want)
+		}
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		paper, err := getDownloadUrl(ctx, Paper{SourceURL: server.URL + "/scholar-none.html"}, scholarPdfMatcher)
+		if !errors.Is(err, MissingDownloadLinkErr) {
+			t.Fatalf("getDownloadUrl error = %v, want MissingDownloadLinkErr", err)
+		}
+		if paper.DownloadURL != "" {
+			t.Errorf("getDownloadUrl = %q, want no URL", paper.DownloadURL)
+		}
+	})
+
+	t.Run("several matches", func(t *testing.T) {
+		paper, err := getDownloadUrl(ctx, Paper{SourceURL: server.URL + "/scholar-many.html"}, scholarPdfMatcher)
+		if !errors.Is(err, TooManyDownloadLinksErr) {
+			t.Fatalf("getDownloadUrl error = %v, want TooManyDownloadLinksErr", err)
+		}
+		// the PDF on the page's own host is preferred
+		if want := server.URL + "/papers/second.pdf"; paper.DownloadURL != want {
+			t.Errorf("getDownloadUrl = %q, want %q", paper.DownloadURL, want)
+		}
+		var tooMany *TooManyDownloadLinksError
+		if !errors.As(err, &tooMany) || len(tooMany.URLs) != 2 {
+			t.Errorf("getDownloadUrl error = %v, want both candidate URLs", err)
+		}
+	})
+
+	t.Run("all versions", func(t *testing.T) {
+		// the ieee-security.org PDF is behind a JavaScript check, so the
+		// other versions Scholar lists are looked through instead
+		scholarUrl := config.scholarUrl
+		config.scholarUrl = server.URL + "/scholar"
+		defer func() { config.scholarUrl = scholarUrl }()
+
+		paper, err := getDownloadUrl(ctx, Paper{SourceURL: server.URL + "/scholar-ieee.html"}, scholarPdfMatcher)
+		if err != nil {
+			t.Fatalf("getDownloadUrl returned error: %s", err)
+		}
+		if want := server.URL + "/papers/safe-preprint.pdf"; paper.DownloadURL != want {
+			t.Errorf("getDownloadUrl = %q, want %q", paper.DownloadURL, want)
+		}
+	})
+}
+
+// encodedHandler serves the testdata file named by the request path encoded
+// with encoding, whether or not the client asked for it, like some conference
+// servers do. "raw deflate" is deflate without the zlib wrapper.
+func encodedHandler(t *testing.T, encoding string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, err := ioutil.ReadFile(path.Join("testdata", r.URL.Path))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		var compressed bytes.Buffer
+		var writer io.WriteCloser
+		switch encoding {
+		case "gzip":
+			writer = gzip.NewWriter(&compressed)
+		case "deflate":
+			writer = zlib.NewWriter(&compressed)
+		case "raw deflate":
+			writer, _ = flate.NewWriter(&compressed, flate.DefaultCompression)
+		default:
+			t.Errorf("unknown encoding %q", encoding)
+			http.Error(w, "unknown encoding", http.StatusInternalServerError)
+			return
+		}
+		writer.Write(page)
+		if err := writer.Close(); err != nil {
+			t.Errorf("compressing %s: %s", r.URL.Path, err)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw "))
+		w.Write(compressed.Bytes())
+	})
+}
+
+func TestFetchPageGzip(t *testing.T) {
+	newTestServer(t)
+	server := httptest.NewServer(encodedHandler(t, "gzip"))
+	defer server.Close()
+
+	root, err := fetchPage(context.Background(), server.URL+"/scholar-single.html")
+	if err != nil {
+		t.Fatalf("fetchPage returned error: %s", err)
+	}
+	if links := scrape.FindAll(root, scholarPdfMatcher); len(links) != 1 {
+		t.Errorf("found %d PDF links on the gzip encoded page, want 1", len(links))
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	newTestServer(t)
+	want, err := ioutil.ReadFile("testdata/scholar-single.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range []string{"gzip", "deflate", "raw deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			server := httptest.NewServer(encodedHandler(t, encoding))
+			defer server.Close()
+
+			// asking for the encoding ourselves keeps the transport from
+			// decompressing it
+			req, err := newRequest(context.Background(), server.URL+"/scholar-single.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept-Encoding", "gzip, deflate")
+			resp, err := doRequest(req)
+			if err != nil {
+				t.Fatalf("doRequest returned error: %s", err)
+			}
+			defer resp.Body.Close()
+			if resp.Header.Get("Content-Encoding") == "" {
+				t.Fatal("the transport decoded the body already")
+			}
+
+			body, err := decodeBody(resp)
+			if err != nil {
+				t.Fatalf("decodeBody returned error: %s", err)
+			}
+			got, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatalf("reading the decoded body: %s", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("decodeBody returned %q, want the page %q", got, want)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		resp := &http.Response{Header: http.Header{"Content-Encoding": {"br"}}, Body: ioutil.NopCloser(bytes.NewReader(want))}
+		if _, err := decodeBody(resp); err == nil {
+			t.Error("decodeBody accepted a Content-Encoding of br")
+		}
+	})
+}
+
+func TestGetLinks(t *testing.T) {
+	fake := useFakeFetcher(t)
+
+	conf := Conference{Name: "USENIX", Year: 2020}
+	pageUrl := "https://www.usenix.org/usenix-program.html"
+	links, err := getLinks(context.Background(), conf, pageUrl, usenixPaperMatcher)
+	if err != nil {
+		t.Fatalf("getLinks returned error: %s", err)
+	}
+	want := []Paper{
+		{Title: "Fast Things Considered Harmful", SourceURL: pageUrl, DownloadURL: "https://www.usenix.org/conference/usenixsecurity20/presentation/fast", Conference: conf},
+		{Title: "Safe Things", SourceURL: pageUrl, DownloadURL: "https://www.usenix.org/conference/usenixsecurity20/presentation/safe", Conference: conf},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("getLinks returned %d links, want %d: %v", len(links), len(want), links)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(links[i], want[i]) {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+	if len(fake.requested) != 1 || fake.requested[0] != "/usenix-program.html" {
+		t.Errorf("requested %v, want only the program page", fake.requested)
+	}
+}
+
+func TestGetPaginatedLinksKeepsEarlierPages(t *testing.T) {
+	fake := useFakeFetcher(t)
+
+	// paged-2.html links to a paged-3.html that doesn't exist
+	conf := Conference{Name: "USENIX", Year: 2020}
+	links, err := getPaginatedLinks(context.Background(), conf, "https://www.usenix.org/paged-1.html", usenixPaperMatcher, nextPageMatcher)
+	if err != nil {
+		t.Fatalf("getPaginatedLinks returned error: %s", err)
+	}
+	want := []Paper{
+		{Title: "Paper 1", SourceURL: "https://www.usenix.org/paged-1.html", DownloadURL: "https://www.usenix.org/conference/usenixsecurity20/presentation/paper-1", Conference: conf},
+		{Title: "Paper 2", SourceURL: "https://www.usenix.org/paged-2.html", DownloadURL: "https://www.usenix.org/conference/usenixsecurity20/presentation/paper-2", Conference: conf},
+	}
+	if len(links) != len(want) {
+		t.Fatalf("getPaginatedLinks returned %d links, want %d: %v", len(links), len(want), links)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(links[i], want[i]) {
+			t.Errorf("link %d = %+v, want %+v", i, links[i], want[i])
+		}
+	}
+	if len(fake.requested) != 3 {
+		t.Errorf("requested %v, want all three pages", fake.requested)
+	}
+
+	if _, err := getPaginatedLinks(context.Background(), conf, "https://www.usenix.org/paged-0.html", usenixPaperMatcher, nextPageMatcher); err == nil {
+		t.Error("getPaginatedLinks returned no error for a missing first page")
+	}
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	server := newTestServer(t)
+	dir := t.TempDir()
+	filepath := path.Join(dir, "missing.pdf")
+
+	result, err := downloadFile(context.Background(), server.URL+"/papers/missing.pdf", filepath, nil)
+	var statusErr *UnexpectedStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("downloadFile error = %v, want a 404 UnexpectedStatusError", err)
+	}
+	if result.Bytes != 0 {
+		t.Errorf("downloadFile wrote %d bytes", result.Bytes)
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Errorf("downloadFile left %s behind", file.Name())
+	}
+}
+
+func TestRedirectBackWithSessionCookie(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/landing", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "1", Path: "/"})
+			http.Redirect(w, r, "/landing", http.StatusFound)
+			return
+		}
+		io.WriteString(w, "ok")
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(jar http.CookieJar) { cookieJar, httpClient.Jar = jar, jar }(cookieJar)
+	cookieJar, httpClient.Jar = jar, jar
+
+	resp, err := httpClient.Get(server.URL + "/landing")
+	if err != nil {
+		t.Fatalf("redirect back to the landing page failed: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("landing page status = %s, want 200 OK", resp.Status)
+	}
+
+	_, err = httpClient.Get(server.URL + "/loop")
+	if err == nil || !strings.Contains(err.Error(), "redirect loop") {
+		t.Errorf("redirect to the same page without cookies returned %v, want a redirect loop", err)
+	}
+}
+
+func TestCreateConfDirectoryConcurrently(t *testing.T) {
+	outputDirectory := t.TempDir()
+	conf := Conference{Name: "USENIX", Year: 2020}
+
+	const workers = 50
+	var wg sync.WaitGroup
+	dirs := make([]string, workers)
+	errs := make([]error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dirs[i], errs[i] = createConfDirectory(outputDirectory, conf)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < workers; i++ {
+		if errs[i] != nil {
+			t.Fatalf("createConfDirectory returned error: %s", errs[i])
+		}
+		if dirs[i] != dirs[0] {
+			t.Errorf("createConfDirectory returned %s and %s", dirs[0], dirs[i])
+		}
+	}
+	if info, err := os.Stat(dirs[0]); err != nil || !info.IsDir() {
+		t.Fatalf("%s is not a directory: %v", dirs[0], err)
+	}
+	files, err := ioutil.ReadDir(outputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("output directory has %d entries, want the single conference directory", len(files))
+	}
+}
+
+func TestFlatLayout(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.outputDirectory = t.TempDir()
+	config.outputLayout = "flat"
+	config.flat = true
+
+	run, err := newConferenceRun(Conference{Name: "USENIX", Year: 2020})
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloadUrl := "https://www.usenix.org/system/files/sec20-fast.pdf"
+	filename := run.claimFilename("sec20-fast.pdf", downloadUrl)
+	if filename != "USENIX_2020_sec20-fast.pdf" {
+		t.Errorf("claimFilename = %s, want USENIX_2020_sec20-fast.pdf", filename)
+	}
+	run.index = append(run.index, IndexEntry{Filename: filename, DownloadUrl: downloadUrl})
+	run.checksums[filename] = "0123"
+	if err := run.writeIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.writeChecksums(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(config.outputDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if file.IsDir() {
+			t.Errorf("flat layout created directory %s", file.Name())
+		}
+		names = append(names, file.Name())
+	}
+	want := []string{"USENIX_2020_checksums.txt", "USENIX_2020_index.json"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("output directory has %v, want %v", names, want)
+	}
+
+	resumed, err := newConferenceRun(Conference{Name: "USENIX", Year: 2020})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.checksums[filename] != "0123" || resumed.filenameUrls[filename] != downloadUrl {
+		t.Errorf("files of the flat layout weren't read back: %v %v", resumed.checksums, resumed.filenameUrls)
+	}
+}
+
+func TestDuplicateOfFailedDownload(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	server := newTestServer(t)
+	config.outputDirectory = t.TempDir()
+	config.arxivFallback = false
+	config.waybackFallback = false
+
+	run, err := newConferenceRun(Conference{Name: "USENIX", Year: 2020})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paper := Paper{Title: "Missing", SourceURL: server.URL, DownloadURL: server.URL + "/missing.pdf"}
+	if run.downloadPaperFrom(context.Background(), paper, "", nil) {
+		t.Error("downloadPaperFrom reported a missing paper as downloaded")
+	}
+	if run.downloadPaperFrom(context.Background(), paper, "", nil) {
+		t.Error("downloadPaperFrom reported a duplicate of a failed download as downloaded")
+	}
+	if run.failed != 1 || run.duplicates != 1 {
+		t.Errorf("failed = %d, duplicates = %d, want 1 and 1", run.failed, run.duplicates)
+	}
+}
+
+func TestParallelDownloads(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved; pool = nil })
+	newTestServer(t)
+	config.outputDirectory = t.TempDir()
+	config.minSize = 0
+	pool = newDownloadPool(4, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/missing") {
+			http.NotFound(w, r)
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF-1.4 "+r.URL.Path)
+	}))
+	t.Cleanup(server.Close)
+
+	run, err := newConferenceRun(Conference{Name: "USENIX", Year: 2020})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for page := 0; page < 4; page++ {
+		b := new(batch)
+		for i := 0; i < 3; i++ {
+			name := fmt.Sprintf("paper-%d-%d.pdf", page, i)
+			if page == 3 && i == 2 {
+				name = "missing.pdf"
+			}
+			run.downloadPaper(ctx, Paper{Title: name, SourceURL: server.URL, DownloadURL: server.URL + "/" + name}, b)
+		}
+		run.markProcessed(fmt.Sprintf("page-%d", page), b)
+	}
+	run.wait()
+
+	if run.downloaded != 11 || run.failed != 1 || len(run.index) != 11 {
+		t.Errorf("downloaded %d, failed %d, indexed %d, want 11, 1 and 11", run.downloaded, run.failed, len(run.index))
+	}
+	for page := 0; page < 4; page++ {
+		entries, ok := state.lookup(run.conf, fmt.Sprintf("page-%d", page))
+		if page < 3 && (!ok || len(entries) != 3) {
+			t.Errorf("page %d recorded with %d entries, want 3", page, len(entries))
+		} else if page == 3 && ok {
+			t.Errorf("page %d with a failed download recorded as processed", page)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// ManifestEntry describes a single downloaded paper across all conferences.
+type ManifestEntry struct {
+	Conference    string `json:"conference"`
+	Year          int    `json:"year"`
+	Title         string `json:"title,omitempty"`
+	SourcePageUrl string `json:"sourcePageUrl"`
+	DownloadUrl   string `json:"downloadUrl"`
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	Sha256        string `json:"sha256"`
+	// Source is where the paper came from instead of the conference, as in
+	// IndexEntry
+	Source string `json:"source,omitempty"`
+	// cache validators the paper was served with, for conditional requests
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+var (
+	manifest = make([]ManifestEntry, 0)
+	// validators of the downloaded papers, keyed by path
+	downloadValidators   = make(map[string]pageValidator)
+	downloadValidatorsMu sync.Mutex
+)
+
+// downloadValidator returns the validators the paper at filepath was served
+// with, if known.
+func downloadValidator(filepath string) (pageValidator, bool) {
+	downloadValidatorsMu.Lock()
+	defer downloadValidatorsMu.Unlock()
+	validator, known := downloadValidators[filepath]
+	return validator, known
+}
+
+func setDownloadValidator(filepath string, validator pageValidator) {
+	downloadValidatorsMu.Lock()
+	defer downloadValidatorsMu.Unlock()
+	downloadValidators[filepath] = validator
+}
+
+func sha256File(filepath string) (string, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// readManifest reads the manifest written by previous runs from the output
+// directory. A missing manifest yields no entries.
+func readManifest(outputDirectory string) ([]ManifestEntry, error) {
+	filepath := path.Join(outputDirectory, "manifest.json")
+	bytes, err := ioutil.ReadFile(filepath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []ManifestEntry
+	if err := json.Unmarshal(bytes, &entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", filepath, err)
+	}
+	return entries, nil
+}
+
+// loadDownloadValidators reads the validators of the papers downloaded by
+// previous runs from the manifest in the output directory. A missing manifest
+// yields no validators.
+func loadDownloadValidators(outputDirectory string) (map[string]pageValidator, error) {
+	validators := make(map[string]pageValidator)
+	entries, err := readManifest(outputDirectory)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.ETag != "" || entry.LastModified != "" {
+			validators[entry.Path] = pageValidator{ETag: entry.ETag, LastModified: entry.LastModified}
+		}
+	}
+	return validators, nil
+}
+
+// writeManifest writes every paper recorded during the run to manifest.json in
+// the output directory. The entries previous runs recorded for conferences not
+// among runs are kept.
+func writeManifest(outputDirectory string, runs []*conferenceRun) error {
+	previous, err := readManifest(outputDirectory)
+	if err != nil {
+		return err
+	}
+	processed := make(map[string]bool)
+	for _, run := range runs {
+		processed[run.conf.String()] = true
+	}
+	entries := make([]ManifestEntry, 0, len(previous)+len(manifest))
+	for _, entry := range previous {
+		if !processed[fmt.Sprintf("%s %d", entry.Conference, entry.Year)] {
+			entries = append(entries, entry)
+		}
+	}
+	entries = append(entries, manifest...)
+	bytes, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path.Join(outputDirectory, "manifest.json"), bytes, 0644)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"strings"
+)
+
+// MatcherSpec describes the paper links of a conference page declaratively, so
+// venues that simply link every PDF from one page need no parser of their own.
+// Every condition given must hold for an element to match.
+type MatcherSpec struct {
+	// element name, "a" if empty
+	Atom string `json:"atom,omitempty" yaml:"atom,omitempty"`
+	// class attribute the element's parent must have
+	ParentClass  string `json:"parentClass,omitempty" yaml:"parentClass,omitempty"`
+	TextEquals   string `json:"textEquals,omitempty" yaml:"textEquals,omitempty"`
+	TextContains string `json:"textContains,omitempty" yaml:"textContains,omitempty"`
+	HrefSuffix   string `json:"hrefSuffix,omitempty" yaml:"hrefSuffix,omitempty"`
+}
+
+// elementAtom returns the atom of the elements the spec matches, or 0 if the
+// element name is unknown.
+func (s *MatcherSpec) elementAtom() atom.Atom {
+	if s.Atom == "" {
+		return atom.A
+	}
+	return atom.Lookup([]byte(strings.ToLower(s.Atom)))
+}
+
+// validate returns a description of every problem with the spec.
+func (s *MatcherSpec) validate() []string {
+	problems := make([]string, 0)
+	if s.elementAtom() == 0 {
+		problems = append(problems, fmt.Sprintf("unknown matcher atom %q", s.Atom))
+	}
+	if s.ParentClass == "" && s.TextEquals == "" && s.TextContains == "" && s.HrefSuffix == "" {
+		problems = append(problems, "matcher needs at least one of parentClass, textEquals, textContains or hrefSuffix")
+	}
+	return problems
+}
+
+// matcher builds the scrape.Matcher described by the spec.
+func (s *MatcherSpec) matcher() scrape.Matcher {
+	elementAtom := s.elementAtom()
+	return func(n *html.Node) bool {
+		if n.DataAtom != elementAtom {
+			return false
+		}
+		if s.ParentClass != "" && (n.Parent == nil || scrape.Attr(n.Parent, "class") != s.ParentClass) {
+			return false
+		}
+		text := strings.TrimSpace(scrape.Text(n))
+		if s.TextEquals != "" && text != s.TextEquals {
+			return false
+		}
+		if s.TextContains != "" && !strings.Contains(text, s.TextContains) {
+			return false
+		}
+		return s.HrefSuffix == "" || strings.HasSuffix(scrape.Attr(n, "href"), s.HrefSuffix)
+	}
+}
+
+// fetchMatchedConference downloads every link on the conference page matched
+// by the conference's matcher spec, following the next page links matched by
+// its nextPage spec if it has one.
+func fetchMatchedConference(ctx context.Context, conf Conference) (*conferenceRun, error) {
+	run, err := newConferenceRun(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []Paper
+	if conf.NextPage != nil {
+		links, err = getPaginatedLinks(ctx, conf, conf.URL, conf.Matcher.matcher(), conf.NextPage.matcher())
+	} else {
+		links, err = getLinks(ctx, conf, conf.URL, conf.Matcher.matcher())
+	}
+	if err != nil {
+		return run, err
+	}
+	if len(links) == 0 {
+		logger.warnf("%s", &URLError{Conference: conf.String(), PageUrl: conf.URL, Err: MissingDownloadLinkErr})
+	}
+	for _, link := range links {
+		if ctx.Err() != nil || run.limitReached() {
+			break
+		}
+		run.downloadPaper(ctx, link, nil)
+	}
+	return run, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+)
+
+// PaperMetadata describes a resolved paper for -metadata-only.
+type PaperMetadata struct {
+	Conference string `json:"conference"`
+	Year       int    `json:"year"`
+	Title      string `json:"title,omitempty"`
+	PageUrl    string `json:"pageUrl"`
+	PdfUrl     string `json:"pdfUrl"`
+}
+
+var (
+	metadata = make([]PaperMetadata, 0)
+)
+
+// writeMetadata writes the papers resolved during the run to filename, as CSV
+// if it has a .csv extension and as JSON otherwise.
+func writeMetadata(filename string) error {
+	if !strings.EqualFold(path.Ext(filename), ".csv") {
+		bytes, err := json.MarshalIndent(metadata, "", "  ")
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, bytes, 0644)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"conference", "year", "title", "pageUrl", "pdfUrl"})
+	for _, paper := range metadata {
+		w.Write([]string{paper.Conference, fmt.Sprint(paper.Year), paper.Title, paper.PageUrl, paper.PdfUrl})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"net/url"
+	"strings"
+)
+
+// computerOrgHost serves the IEEE Computer Society Digital Library, which has
+// the official proceedings of IEEE S&P.
+const computerOrgHost = "www.computer.org"
+
+func isComputerOrgUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && u.Host == computerOrgHost
+}
+
+// computerOrgArticleMatcher matches the links to the article pages of a
+// proceedings listing.
+func computerOrgArticleMatcher(n *html.Node) bool {
+	return n.DataAtom == atom.A && strings.Contains(scrape.Attr(n, "href"), "/csdl/proceedings-article/")
+}
+
+// computerOrgPdfMatcher matches the PDF download link of an article page.
+func computerOrgPdfMatcher(n *html.Node) bool {
+	if n.DataAtom != atom.A {
+		return false
+	}
+	href := scrape.Attr(n, "href")
+	return strings.Contains(href, "/download-article/") || strings.HasSuffix(href, ".pdf")
+}
+
+// downloadFromComputerOrg downloads the papers of the official proceedings
+// listing at the conference URL, falling back to Google Scholar for the papers
+// whose article page has no PDF link.
+func (r *conferenceRun) downloadFromComputerOrg(ctx context.Context) error {
+	articles, err := getLinks(ctx, r.conf, r.conf.URL, computerOrgArticleMatcher)
+	if err != nil {
+		return err
+	}
+	if len(articles) == 0 {
+		logger.warnf("%s", &URLError{Conference: r.conf.String(), PageUrl: r.conf.URL, Err: MissingDownloadLinkErr})
+	}
+
+	unresolved := make([]Paper, 0)
+	for _, article := range articles {
+		if ctx.Err() != nil || r.limitReached() {
+			break
+		}
+		paper, err := getDownloadUrl(ctx, article.paperPage(), computerOrgPdfMatcher)
+		if errors.Is(err, MissingDownloadLinkErr) || errors.Is(err, RobotsDisallowedErr) {
+			logger.debugf("no PDF on %s, looking %q up on Google Scholar", paper.SourceURL, paper.Title)
+			unresolved = append(unresolved, paper)
+			continue
+		} else if err != nil && !errors.Is(err, TooManyDownloadLinksErr) {
+			logger.errorf("%s", err)
+			continue
+		}
+		r.downloadPaper(ctx, paper, nil)
+	}
+	if len(unresolved) > 0 {
+		r.downloadFromScholar(ctx, unresolved)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// pageCachePath returns where the cached copy of pageUrl is stored in the
+// -cache-dir directory.
+func pageCachePath(pageUrl string) string {
+	sum := sha256.Sum256([]byte(pageUrl))
+	return path.Join(config.cacheDirectory, hex.EncodeToString(sum[:])+".html")
+}
+
+// cachedPage returns the cached copy of pageUrl if -cache is set and the copy
+// is younger than -cache-ttl.
+func cachedPage(pageUrl string) ([]byte, bool) {
+	if !config.cache {
+		return nil, false
+	}
+	filepath := pageCachePath(pageUrl)
+	info, err := os.Stat(filepath)
+	if err != nil || time.Since(info.ModTime()) > config.cacheTtl {
+		return nil, false
+	}
+	page, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		logger.warnf("could not read cached copy of %s: %s", pageUrl, err)
+		return nil, false
+	}
+	return page, true
+}
+
+// isCacheable reports whether resp is a successful HTML or text response; PDFs
+// and error pages are never cached.
+func isCacheable(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && (strings.HasPrefix(mediaType, "text/") || mediaType == "application/xhtml+xml")
+}
+
+// storeCachedPage saves page as the cached copy of pageUrl.
+func storeCachedPage(pageUrl string, page []byte) error {
+	if err := os.MkdirAll(config.cacheDirectory, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(pageCachePath(pageUrl), page, 0644)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"github.com/yhat/scrape"
+)
+
+// Paper is a paper found on a conference page, along with what the page tells
+// about it and, once resolved, where to download it from.
+type Paper struct {
+	Title    string
+	Authors  string
+	Abstract string
+	// page the paper was found on
+	SourceURL string
+	// URL of the PDF, empty until resolved
+	DownloadURL string
+	Conference  Conference
+}
+
+// paperPage returns the paper found on the page p links to, for listings that
+// link a page per paper instead of its PDF.
+func (p Paper) paperPage() Paper {
+	return Paper{Title: p.Title, SourceURL: p.DownloadURL, Conference: p.Conference}
+}
+
+// DownloadResult is what downloadFile did with a download URL.
+type DownloadResult struct {
+	// path the file was stored at, which the server may have picked
+	Path string
+	// number of bytes written, 0 if the file already existed
+	Bytes int64
+}
+
+// getPapers returns the papers of conf whose titles are matched by matcher on
+// the page at pageUrl, for conferences that only list paper titles.
+func getPapers(ctx context.Context, conf Conference, pageUrl string, matcher scrape.Matcher) ([]Paper, error) {
+	root, err := fetchHTML(ctx, pageUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// grab all paper titles
+	titleNodes := scrape.FindAll(root, matcher)
+	papers := make([]Paper, 0, len(titleNodes))
+	for _, title := range titleNodes {
+		papers = append(papers, Paper{Title: scrape.Text(title), SourceURL: pageUrl, Conference: conf})
+	}
+	return papers, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ReportRow is a line of the -report-csv report, describing a download attempt.
+type ReportRow struct {
+	Conference  string
+	Year        int
+	Title       string
+	PageUrl     string
+	DownloadUrl string
+	LocalPath   string
+	// one of downloaded, skipped, disallowed or failed
+	Status string
+	Bytes  int64
+	Sha256 string
+	Error  string
+}
+
+var (
+	report = make([]ReportRow, 0)
+)
+
+// reportDownload records the outcome of downloading the paper described by
+// entry to filepath for -report-csv. The status is downloaded or skipped for
+// successful downloads and taken from err otherwise.
+func (r *conferenceRun) reportDownload(entry IndexEntry, filepath, status string, bytes int64, sum string, err error) {
+	if config.reportCsv == "" {
+		return
+	}
+	row := ReportRow{
+		Conference:  r.conf.Name,
+		Year:        r.conf.Year,
+		Title:       entry.Title,
+		PageUrl:     entry.SourcePageUrl,
+		DownloadUrl: entry.DownloadUrl,
+		LocalPath:   filepath,
+		Status:      status,
+		Bytes:       bytes,
+		Sha256:      sum,
+	}
+	if errors.Is(err, RobotsDisallowedErr) {
+		row.Status = "disallowed"
+	} else if err != nil {
+		row.Status = "failed"
+		row.Error = err.Error()
+	}
+	report = append(report, row)
+}
+
+// writeReportCsv writes the download attempts of the run to filename as CSV.
+func writeReportCsv(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"conference", "year", "title", "page_url", "download_url", "local_path", "status", "bytes", "sha256", "error"})
+	for _, row := range report {
+		w.Write([]string{row.Conference, fmt.Sprint(row.Year), row.Title, row.PageUrl, row.DownloadUrl, row.LocalPath, row.Status, fmt.Sprint(row.Bytes), row.Sha256, row.Error})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runResolve implements the resolve subcommand, which resolves the download
+// URL of a single page with a matcher given on the command line, without
+// reading the conferences file or downloading anything. It returns the exit
+// status.
+func runResolve(args []string) int {
+	flags := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	var pageUrl string
+	var all bool
+	var spec MatcherSpec
+	flags.StringVar(&pageUrl, "url", "", "page to resolve the download URL on")
+	flags.StringVar(&spec.Atom, "atom", "", "element to match, a if empty")
+	flags.StringVar(&spec.ParentClass, "parent-class", "", "class attribute the matched element's parent must have")
+	flags.StringVar(&spec.TextEquals, "match-text", "", "text the matched element must have")
+	flags.StringVar(&spec.TextContains, "match-text-contains", "", "text the matched element must contain")
+	flags.StringVar(&spec.HrefSuffix, "href-suffix", "", "suffix the matched element's href must have")
+	flags.BoolVar(&all, "all", false, "print every matching link instead of only the first")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s resolve -url URL [matcher flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitFatal
+	}
+	if pageUrl == "" {
+		fmt.Fprintln(flags.Output(), "resolve: -url is required")
+		flags.Usage()
+		return exitFatal
+	}
+	if problems := spec.validate(); len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintf(flags.Output(), "resolve: %s\n", problem)
+		}
+		return exitFatal
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var downloadUrls []string
+	var err error
+	if all {
+		downloadUrls, err = getDownloadUrls(ctx, pageUrl, spec.matcher())
+	} else {
+		var paper Paper
+		paper, err = getDownloadUrl(ctx, Paper{SourceURL: pageUrl}, spec.matcher())
+		if paper.DownloadURL != "" {
+			downloadUrls = []string{paper.DownloadURL}
+		}
+	}
+	for _, downloadUrl := range downloadUrls {
+		fmt.Println(downloadUrl)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "resolve: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// robotsRules holds the Allow and Disallow path patterns of a robots.txt that
+// apply to us.
+type robotsRules struct {
+	allow    []string
+	disallow []string
+}
+
+// parseRobots reads the rules of the robots.txt group for the given user
+// agent, falling back to the group for all user agents ("*").
+func parseRobots(r io.Reader, agent string) (*robotsRules, error) {
+	agent = strings.ToLower(agent)
+	specific, wildcard := &robotsRules{}, &robotsRules{}
+	foundSpecific := false
+	// the rule sets of the group being read, nil if it doesn't apply to us
+	var groups []*robotsRules
+	// consecutive user-agent lines share a group
+	readingAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if !readingAgents {
+				groups = nil
+			}
+			readingAgents = true
+			if value == "*" {
+				groups = append(groups, wildcard)
+			} else if value != "" && strings.Contains(agent, strings.ToLower(value)) {
+				groups = append(groups, specific)
+				foundSpecific = true
+			}
+		case "allow", "disallow":
+			readingAgents = false
+			// an empty Disallow allows everything
+			if value == "" {
+				continue
+			}
+			for _, rules := range groups {
+				if key == "allow" {
+					rules.allow = append(rules.allow, value)
+				} else {
+					rules.disallow = append(rules.disallow, value)
+				}
+			}
+		default:
+			readingAgents = false
+		}
+	}
+
+	if foundSpecific {
+		return specific, scanner.Err()
+	}
+	return wildcard, scanner.Err()
+}
+
+// allowed reports whether path, with its query if any, may be fetched. The
+// longest matching pattern wins, with Allow winning ties.
+func (r *robotsRules) allowed(path string) bool {
+	longest := func(patterns []string) int {
+		n := -1
+		for _, pattern := range patterns {
+			if len(pattern) > n && robotsPatternMatches(pattern, path) {
+				n = len(pattern)
+			}
+		}
+		return n
+	}
+	return longest(r.allow) >= longest(r.disallow)
+}
+
+// robotsPatternMatches reports whether path matches a robots.txt path pattern
+// as defined by RFC 9309: a prefix in which * matches any sequence of
+// characters and a trailing $ anchors the end of the path.
+func robotsPatternMatches(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	rest := path[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || rest == ""
+	}
+	// matching the parts in between as early as possible leaves the most
+	// room for the rest
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(rest, part)
+		if i < 0 {
+			return false
+		}
+		rest = rest[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	if anchored {
+		return strings.HasSuffix(rest, last)
+	}
+	return strings.Contains(rest, last)
+}
+
+// robotsCache fetches and remembers the robots.txt rules of each host.
+type robotsCache struct {
+	mu    sync.Mutex
+	rules map[string]*robotsRules
+}
+
+var (
+	robots = &robotsCache{rules: make(map[string]*robotsRules)}
+)
+
+// allowed reports whether rawurl may be fetched according to its host's
+// robots.txt. Hosts whose robots.txt can't be fetched are assumed to allow
+// everything.
+func (c *robotsCache) allowed(ctx context.Context, rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rules, ok := c.rules[u.Host]
+	if !ok {
+		rules = fetchRobots(ctx, u.Scheme+"://"+u.Host+"/robots.txt")
+		c.rules[u.Host] = rules
+	}
+	return rules.allowed(u.RequestURI())
+}
+
+func fetchRobots(ctx context.Context, robotsUrl string) *robotsRules {
+	req, err := newRequest(ctx, robotsUrl)
+	if err != nil {
+		return &robotsRules{}
+	}
+	if err := throttle.wait(ctx, robotsUrl); err != nil {
+		return &robotsRules{}
+	}
+	resp, err := fetcher.Do(req)
+	if err != nil {
+		logger.debugf("could not fetch %s: %s", robotsUrl, err)
+		return &robotsRules{}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		logger.debugf("no robots.txt at %s: %s", robotsUrl, resp.Status)
+		return &robotsRules{}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		logger.debugf("could not read %s: %s", robotsUrl, err)
+		return &robotsRules{}
+	}
+	rules, err := parseRobots(body, userAgent)
+	if err != nil {
+		logger.debugf("could not read %s: %s", robotsUrl, err)
+	}
+	return rules
+}
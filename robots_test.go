@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRobotsPatternMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/papers/", "/papers/sec20.pdf", true},
+		{"/papers/", "/paper.pdf", false},
+		{"/*.pdf$", "/system/files/sec20.pdf", true},
+		{"/*.pdf$", "/system/files/sec20.pdf?download=1", false},
+		{"/*.pdf$", "/system/files/sec20.pdf.html", false},
+		{"/*.pdf", "/system/files/sec20.pdf.html", true},
+		{"/*/files/*.pdf", "/system/files/sec20.pdf", true},
+		{"/*/files/*.pdf", "/system/sec20.pdf", false},
+		{"/*?session=", "/program?session=1", true},
+		{"/program$", "/program", true},
+		{"/program$", "/programs", false},
+		{"*", "/anything", true},
+		{"/a*b*b$", "/abb", true},
+		{"/a*b*b$", "/ab", false},
+	}
+	for _, test := range tests {
+		if got := robotsPatternMatches(test.pattern, test.path); got != test.want {
+			t.Errorf("robotsPatternMatches(%q, %q) = %v, want %v", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestRobotsRulesAllowed(t *testing.T) {
+	rules, err := parseRobots(strings.NewReader(`
+User-agent: *
+Disallow: /*.pdf$
+Allow: /system/files/*.pdf$
+Disallow: /private
+`), userAgent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/conference/sec20/paper.pdf", false},
+		{"/system/files/sec20-paper.pdf", true},
+		{"/conference/sec20/paper.pdf?inline", true},
+		{"/private/notes.html", false},
+		{"/conference/sec20/technical-sessions", true},
+	}
+	for _, test := range tests {
+		if got := rules.allowed(test.path); got != test.want {
+			t.Errorf("allowed(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
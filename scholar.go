@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/yhat/scrape"
+	"golang.org/x/net/html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// markers of the page Google Scholar serves instead of results once it
+// decides we are a robot
+var scholarBlockedMarkers = []string{
+	"gs_captcha",
+	"g-recaptcha",
+	"unusual traffic from your computer network",
+}
+
+// isScholarUrl reports whether rawurl is on Google Scholar or the mirror set
+// with -scholar-url.
+func isScholarUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if mirror, err := url.Parse(config.scholarUrl); err == nil && mirror.Host != "" && u.Host == mirror.Host {
+		return true
+	}
+	return strings.HasPrefix(u.Host, "scholar.google.")
+}
+
+// scholarTitleReplacer normalizes the punctuation of titles that trips up
+// Scholar searches: typographic quotes and dashes become plain ones, and double
+// quotes, which would turn part of the title into a phrase search, are dropped.
+var scholarTitleReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'",
+	"\u201c", "", "\u201d", "", `"`, "",
+	"\u2013", "-", "\u2014", "-",
+	"\u00a0", " ",
+)
+
+// buildScholarQuery returns the percent-encoded query string of a Google
+// Scholar search for title.
+func buildScholarQuery(title string) string {
+	// titles scraped from program pages often span lines
+	normalized := strings.Join(strings.Fields(scholarTitleReplacer.Replace(title)), " ")
+	return url.Values{"q": {normalized}}.Encode()
+}
+
+// scholarSearchUrl returns the -scholar-url search for title.
+func scholarSearchUrl(title string) (string, error) {
+	u, err := url.Parse(config.scholarUrl)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	query.Del("q")
+	u.RawQuery = buildScholarQuery(title)
+	if len(query) > 0 {
+		u.RawQuery = query.Encode() + "&" + u.RawQuery
+	}
+	return u.String(), nil
+}
+
+// checkScholarResponse returns ScholarRateLimitedErr if resp is Google
+// Scholar's rate limiting or CAPTCHA page, which it may redirect to from a
+// search. As the body has to be read to tell,
+// it returns a reader with the same contents to use instead.
+func checkScholarResponse(resp *http.Response, body io.Reader) (io.Reader, error) {
+	if resp.StatusCode == http.StatusTooManyRequests || strings.HasPrefix(resp.Request.URL.Path, "/sorry/") {
+		return nil, ScholarRateLimitedErr
+	}
+
+	page, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	for _, marker := range scholarBlockedMarkers {
+		if bytes.Contains(page, []byte(marker)) {
+			return nil, ScholarRateLimitedErr
+		}
+	}
+	return bytes.NewReader(page), nil
+}
+
+// fetchScholarHTML fetches a Google Scholar page, backing off exponentially
+// from -scholar-backoff while Scholar rate limits us. After -scholar-retries
+// retries it gives up with ScholarRateLimitedErr.
+func fetchScholarHTML(ctx context.Context, pageUrl string) (*html.Node, error) {
+	backoff := config.scholarBackoff
+	for retry := 1; ; retry++ {
+		root, err := fetchPage(ctx, pageUrl)
+		if !errors.Is(err, ScholarRateLimitedErr) || retry > config.scholarRetries {
+			return root, err
+		}
+		logger.warnf("Google Scholar is rate limiting us, retrying in %s (%d of %d)", backoff, retry, config.scholarRetries)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// scholarCacheFilename is the file in the output directory that remembers the
+// download URL Google Scholar gave for each paper title across runs.
+const scholarCacheFilename = "scholar-cache.json"
+
+// scholarResult is what Google Scholar told us about a paper.
+type scholarResult struct {
+	DownloadUrl string `json:"downloadUrl"`
+	Authors     string `json:"authors,omitempty"`
+}
+
+// scholarUrlCache maps normalized paper titles to what Google Scholar resolved
+// them to.
+type scholarUrlCache struct {
+	filepath string
+	results  map[string]scholarResult
+}
+
+var (
+	scholarCache = &scholarUrlCache{results: make(map[string]scholarResult)}
+)
+
+// loadScholarCache reads the cache of Google Scholar lookups from the output
+// directory. A missing cache file yields an empty cache.
+func loadScholarCache(outputDirectory string) (*scholarUrlCache, error) {
+	cache := &scholarUrlCache{
+		filepath: path.Join(outputDirectory, scholarCacheFilename),
+		results:  make(map[string]scholarResult),
+	}
+	bytes, err := ioutil.ReadFile(cache.filepath)
+	if os.IsNotExist(err) {
+		return cache, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &cache.results); err != nil {
+		// caches written before authors were recorded only hold URLs
+		var urls map[string]string
+		if json.Unmarshal(bytes, &urls) != nil {
+			return nil, fmt.Errorf("parsing %s: %s", cache.filepath, err)
+		}
+		for title, downloadUrl := range urls {
+			cache.results[title] = scholarResult{DownloadUrl: downloadUrl}
+		}
+	}
+	return cache, nil
+}
+
+// lookup returns what was cached for title, unless -refresh-cache is set.
+func (c *scholarUrlCache) lookup(title string) (scholarResult, bool) {
+	if config.refreshCache {
+		return scholarResult{}, false
+	}
+	result, ok := c.results[slugify(title)]
+	return result, ok
+}
+
+// store records what was resolved for title and writes the cache, so it
+// survives interrupted runs. Nothing is written in dry-run mode.
+func (c *scholarUrlCache) store(title string, result scholarResult) error {
+	c.results[slugify(title)] = result
+	if config.dryRun || c.filepath == "" {
+		return nil
+	}
+	bytes, err := json.MarshalIndent(c.results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(c.filepath), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.filepath, bytes, 0644)
+}
+
+// getScholarAuthors returns the authors of the first Google Scholar search
+// result, from the line under its title that reads "authors - venue, year -
+// publisher", or "" if there is none.
+func getScholarAuthors(root *html.Node) string {
+	line, ok := scrape.Find(root, func(n *html.Node) bool {
+		return n.Type == html.ElementNode && scrape.Attr(n, "class") == "gs_a"
+	})
+	if !ok {
+		return ""
+	}
+	authors := strings.SplitN(scrape.Text(line), " - ", 2)[0]
+	return strings.TrimSpace(authors)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestScholarSearchUrl(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Cookies & Cream: Tracking", "https://scholar.google.com/scholar?q=Cookies+%26+Cream%3A+Tracking"},
+		{"Ünïcode Domains Considered Harmful", "https://scholar.google.com/scholar?q=%C3%9Cn%C3%AFcode+Domains+Considered+Harmful"},
+		{"Who Is #1? A Study of 100% Rankings", "https://scholar.google.com/scholar?q=Who+Is+%231%3F+A+Study+of+100%25+Rankings"},
+	}
+	for _, test := range tests {
+		got, err := scholarSearchUrl(test.title)
+		if err != nil {
+			t.Fatalf("scholarSearchUrl(%q) returned error: %s", test.title, err)
+		}
+		if got != test.want {
+			t.Errorf("scholarSearchUrl(%q) = %q, want %q", test.title, got, test.want)
+		}
+		// the whole title must arrive as the query
+		u, err := url.Parse(got)
+		if err != nil {
+			t.Fatalf("parsing %q: %s", got, err)
+		}
+		if q := u.Query().Get("q"); q != test.title {
+			t.Errorf("scholarSearchUrl(%q) searches for %q", test.title, q)
+		}
+	}
+}
+
+func TestBuildScholarQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"colon", "SoK: Sanitizing for Security", "q=SoK%3A+Sanitizing+for+Security"},
+		{"ampersand", "Spectre & Meltdown", "q=Spectre+%26+Meltdown"},
+		{"unicode", "Über-Tracking in Ünïcode", "q=%C3%9Cber-Tracking+in+%C3%9Cn%C3%AFcode"},
+		{"typographic quotes", "“Okay, Google”: Voice Assistants’ Privacy", "q=Okay%2C+Google%3A+Voice+Assistants%27+Privacy"},
+		{"plain double quotes", `The "Right" Way`, "q=The+Right+Way"},
+		{"dashes", "Fast—and Safe – Parsing", "q=Fast-and+Safe+-+Parsing"},
+		{"whitespace", "  A Title\n\tSpanning Lines ", "q=A+Title+Spanning+Lines"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := buildScholarQuery(test.title); got != test.want {
+				t.Errorf("buildScholarQuery(%q) = %q, want %q", test.title, got, test.want)
+			}
+		})
+	}
+}
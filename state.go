@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+)
+
+// stateFilename is the file in the output directory recording the paper pages
+// and Scholar titles whose papers were all downloaded by previous runs.
+const stateFilename = "state.json"
+
+// runState maps conferences to their processed paper pages or titles, and
+// those to the index entries of the papers they yielded.
+type runState struct {
+	filepath string
+	// mu guards conferences against downloads finishing in the background
+	mu          sync.Mutex
+	conferences map[string]map[string][]IndexEntry
+}
+
+var (
+	state = &runState{conferences: make(map[string]map[string][]IndexEntry)}
+)
+
+// loadState reads the state of previous runs from the output directory. A
+// missing state file yields an empty state.
+func loadState(outputDirectory string) (*runState, error) {
+	s := &runState{
+		filepath:    path.Join(outputDirectory, stateFilename),
+		conferences: make(map[string]map[string][]IndexEntry),
+	}
+	bytes, err := ioutil.ReadFile(s.filepath)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &s.conferences); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", s.filepath, err)
+	}
+	return s, nil
+}
+
+// store records the entries of the page or title key of the conference and
+// writes the state, so it survives runs that die. Nothing is written in
+// dry-run mode.
+func (s *runState) store(conf Conference, key string, entries []IndexEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	processed, ok := s.conferences[conf.String()]
+	if !ok {
+		processed = make(map[string][]IndexEntry)
+		s.conferences[conf.String()] = processed
+	}
+	processed[key] = entries
+	if config.dryRun || s.filepath == "" {
+		return nil
+	}
+	bytes, err := json.MarshalIndent(s.conferences, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.filepath, bytes, 0644)
+}
+
+// lookup returns the entries stored for the page or title key of the
+// conference, if any.
+func (s *runState) lookup(conf Conference, key string) ([]IndexEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, ok := s.conferences[conf.String()][key]
+	return entries, ok
+}
+
+// batch collects the papers downloaded from a paper page or for a title, to
+// record it as processed once all of them are done. A nil batch records
+// nothing.
+type batch struct {
+	// downloads still running in the background
+	downloads sync.WaitGroup
+	// guarded by the mu of the conference run
+	entries []IndexEntry
+	failed  bool
+}
+
+func (b *batch) record(entry IndexEntry) {
+	if b != nil {
+		b.entries = append(b.entries, entry)
+	}
+}
+
+func (b *batch) fail() {
+	if b != nil {
+		b.failed = true
+	}
+}
+
+// restore adds the papers a previous run got from the page or title key to the
+// run, reporting whether it did. Pages whose papers are no longer all on disk
+// have to be processed again, and so do all pages with -overwrite, -update,
+// -preflight or -all-links, which act on downloads already made.
+func (r *conferenceRun) restore(key string) bool {
+	if config.overwrite || config.update || config.preflight || config.allLinks {
+		return false
+	}
+	entries, ok := state.lookup(r.conf, key)
+	if !ok {
+		return false
+	}
+	sizes := make([]int64, len(entries))
+	for i, entry := range entries {
+		info, err := os.Stat(r.paperPath(entry.Filename))
+		if err != nil {
+			return false
+		}
+		sizes[i] = info.Size()
+	}
+	logger.debugf("skipping %s, processed by a previous run", key)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, entry := range entries {
+		r.named++
+		r.resolved++
+		r.skipped++
+		r.seenUrls[entry.DownloadUrl] = true
+		r.filenameUrls[entry.Filename] = entry.DownloadUrl
+		r.index = append(r.index, entry)
+		manifest = append(manifest, r.manifestEntry(entry, sizes[i]))
+	}
+	return true
+}
+
+// markProcessed records in the state that the page or title key was processed,
+// once the downloads of b are done and if all of its papers were downloaded.
+func (r *conferenceRun) markProcessed(key string, b *batch) {
+	r.downloads.Add(1)
+	go func() {
+		defer r.downloads.Done()
+		b.downloads.Wait()
+		r.mu.Lock()
+		entries, failed := b.entries, b.failed
+		r.mu.Unlock()
+		if failed || len(entries) == 0 {
+			return
+		}
+		if err := state.store(r.conf, key, entries); err != nil {
+			logger.errorf("%s", err)
+		}
+	}()
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostThrottle is a token bucket rate limiter per host: each host gets up to
+// burst requests at once, refilled at one token per interval. Requests to
+// different hosts never delay each other.
+type hostThrottle struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    int
+	// time at which each host's bucket will be full again
+	full map[string]time.Time
+}
+
+func newHostThrottle(interval time.Duration, burst int) *hostThrottle {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostThrottle{interval: interval, burst: burst, full: make(map[string]time.Time)}
+}
+
+// wait blocks until a request to the host of rawurl may be sent or ctx is done.
+func (t *hostThrottle) wait(ctx context.Context, rawurl string) error {
+	host := rawurl
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+
+	t.mu.Lock()
+	now := time.Now()
+	full := t.full[host]
+	if full.Before(now) {
+		full = now
+	}
+	// a token is available once the bucket is no more than burst-1 tokens short of full
+	send := full.Add(-time.Duration(t.burst-1) * t.interval)
+	if send.Before(now) {
+		send = now
+	}
+	t.full[host] = full.Add(t.interval)
+	t.mu.Unlock()
+
+	timer := time.NewTimer(send.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// byteRate is a flag.Value for a number of bytes per second, written like
+// 500KB/s or 2MB/s with binary units. 0 means unlimited.
+type byteRate int64
+
+func (r *byteRate) String() string {
+	if *r == 0 {
+		return ""
+	}
+	return formatBytes(int64(*r)) + "/s"
+}
+
+func (r *byteRate) Set(value string) error {
+	n, err := parseByteSize(strings.TrimSuffix(strings.TrimSpace(value), "/s"))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q, expected something like 2MB/s", value)
+	}
+	*r = byteRate(n)
+	return nil
+}
+
+// byteSize is a flag.Value for a number of bytes, written like 500MB or 2GB
+// with binary units.
+type byteSize int64
+
+func (s *byteSize) String() string {
+	if *s == 0 {
+		return ""
+	}
+	return formatBytes(int64(*s))
+}
+
+func (s *byteSize) Set(value string) error {
+	n, err := parseByteSize(value)
+	if err != nil {
+		return fmt.Errorf("invalid size %q, expected something like 500MB", value)
+	}
+	*s = byteSize(n)
+	return nil
+}
+
+// parseByteSize parses a number of bytes with an optional K, M or G binary
+// unit, like 1.5M, 500KB or 2GiB.
+func parseByteSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	multiplier := int64(1)
+	if i := strings.IndexAny(s, "KMG"); i >= 0 && i == len(s)-1 {
+		multiplier = int64(1) << (10 * uint(strings.IndexByte("KMG", s[i])+1))
+		s = s[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// bandwidthLimiter keeps the combined throughput of all downloads under a
+// number of bytes per second.
+type bandwidthLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec int64
+	// time by which the bytes read so far are allowed
+	next time.Time
+}
+
+// wait blocks until n more bytes may be read or ctx is done.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(n) * time.Second / time.Duration(l.bytesPerSec))
+	send := l.next
+	l.mu.Unlock()
+
+	timer := time.NewTimer(send.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// limitedReader reads from r no faster than its limiter allows.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// small reads keep the throughput smooth at low rates
+	if max := int(r.limiter.bytesPerSec / 10); max > 0 && len(p) > max {
+		p = p[:max]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// limitBandwidth wraps body in a reader obeying -max-bandwidth, if it is set.
+func limitBandwidth(ctx context.Context, body io.Reader) io.Reader {
+	if bandwidth == nil {
+		return body
+	}
+	return &limitedReader{ctx: ctx, r: body, limiter: bandwidth}
+}
+
+// downloadPool caps the downloads running at once with -concurrency, and those
+// from a single host with -per-host.
+type downloadPool struct {
+	total   chan struct{}
+	perHost int
+	mu      sync.Mutex
+	hosts   map[string]chan struct{}
+}
+
+func newDownloadPool(total, perHost int) *downloadPool {
+	return &downloadPool{total: make(chan struct{}, total), perHost: perHost, hosts: make(map[string]chan struct{})}
+}
+
+// acquire blocks until a download from the host of rawurl may start or ctx is
+// done. The returned func gives the slot back.
+func (p *downloadPool) acquire(ctx context.Context, rawurl string) (func(), error) {
+	host := rawurl
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+
+	var hostSlots chan struct{}
+	if p.perHost > 0 {
+		p.mu.Lock()
+		hostSlots = p.hosts[host]
+		if hostSlots == nil {
+			hostSlots = make(chan struct{}, p.perHost)
+			p.hosts[host] = hostSlots
+		}
+		p.mu.Unlock()
+		select {
+		case hostSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	// taking the host slot first keeps downloads waiting on a busy host from
+	// holding up other hosts
+	select {
+	case p.total <- struct{}{}:
+	case <-ctx.Done():
+		if hostSlots != nil {
+			<-hostSlots
+		}
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-p.total
+		if hostSlots != nil {
+			<-hostSlots
+		}
+	}, nil
+}
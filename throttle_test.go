@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadPoolPerHost(t *testing.T) {
+	pool := newDownloadPool(10, 1)
+
+	var mu sync.Mutex
+	running := make(map[string]int)
+	maxRunning := make(map[string]int)
+	total, maxTotal := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		host := fmt.Sprintf("host%d.example.org", i%5)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := pool.acquire(context.Background(), "https://"+host+"/paper.pdf")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			running[host]++
+			total++
+			if running[host] > maxRunning[host] {
+				maxRunning[host] = running[host]
+			}
+			if total > maxTotal {
+				maxTotal = total
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			running[host]--
+			total--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	for host, n := range maxRunning {
+		if n > 1 {
+			t.Errorf("%d downloads from %s at once, want at most 1", n, host)
+		}
+	}
+	if maxTotal < 2 || maxTotal > 5 {
+		t.Errorf("%d downloads at once, want 2 to 5 with 5 hosts", maxTotal)
+	}
+}
+
+func TestDownloadPoolCanceled(t *testing.T) {
+	pool := newDownloadPool(1, 0)
+	release, err := pool.acquire(context.Background(), "https://example.org/a.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.acquire(ctx, "https://example.org/b.pdf"); err == nil {
+		t.Error("acquire returned a slot beyond -concurrency")
+	}
+}
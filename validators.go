@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+)
+
+// pageValidatorsFilename is the file in the output directory holding the
+// validators of the conference pages scraped by previous runs.
+const pageValidatorsFilename = "page-validators.json"
+
+// pageValidator holds the HTTP cache validators a page was served with.
+type pageValidator struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// pageValidatorStore maps conference page URLs to the validators they had
+// when they were last scraped completely.
+type pageValidatorStore struct {
+	filepath   string
+	validators map[string]pageValidator
+}
+
+// loadPageValidators reads the page validators from the output directory. A
+// missing file yields no validators.
+func loadPageValidators(outputDirectory string) (*pageValidatorStore, error) {
+	store := &pageValidatorStore{
+		filepath:   path.Join(outputDirectory, pageValidatorsFilename),
+		validators: make(map[string]pageValidator),
+	}
+	bytes, err := ioutil.ReadFile(store.filepath)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bytes, &store.validators); err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", store.filepath, err)
+	}
+	return store, nil
+}
+
+// prefetchedPages holds the pages changed got in full, for fetchPage to use
+// instead of fetching them a second time.
+var prefetchedPages = make(map[string][]byte)
+
+// takePrefetchedPage returns the page changed got for pageUrl, once.
+func takePrefetchedPage(pageUrl string) ([]byte, bool) {
+	page, ok := prefetchedPages[pageUrl]
+	delete(prefetchedPages, pageUrl)
+	return page, ok
+}
+
+// changed asks the server whether the page at pageUrl changed since it was
+// last scraped, with a conditional request. It returns the page's current
+// validators, to be stored once the page has been scraped. A changed page is
+// kept for fetchPage, so scraping it doesn't download it again.
+func (s *pageValidatorStore) changed(ctx context.Context, pageUrl string) (bool, pageValidator, error) {
+	req, err := newRequest(ctx, pageUrl)
+	if err != nil {
+		return true, pageValidator{}, err
+	}
+	previous, ok := s.validators[pageUrl]
+	if ok && previous.ETag != "" {
+		req.Header.Set("If-None-Match", previous.ETag)
+	}
+	if ok && previous.LastModified != "" {
+		req.Header.Set("If-Modified-Since", previous.LastModified)
+	}
+
+	resp, err := doRequest(req)
+	if err != nil {
+		return true, pageValidator{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, previous, nil
+	}
+	if isCacheable(resp) {
+		if body, err := decodeBody(resp); err == nil {
+			if page, err := ioutil.ReadAll(body); err == nil {
+				prefetchedPages[pageUrl] = page
+			}
+		}
+	}
+	return true, pageValidator{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}, nil
+}
+
+// update stores the validators of the page at pageUrl and writes the store.
+func (s *pageValidatorStore) update(pageUrl string, validator pageValidator) error {
+	if validator == (pageValidator{}) {
+		return nil
+	}
+	s.validators[pageUrl] = validator
+	bytes, err := json.MarshalIndent(s.validators, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.filepath, bytes, 0644)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestChangedPageIsFetchedOnce(t *testing.T) {
+	newTestServer(t)
+	requests := 0
+	files := http.FileServer(http.Dir("testdata"))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v2"`)
+		files.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	store, err := loadPageValidators(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageUrl := server.URL + "/usenix-program.html"
+	store.validators[pageUrl] = pageValidator{ETag: `"v1"`}
+
+	changed, validator, err := store.changed(context.Background(), pageUrl)
+	if err != nil {
+		t.Fatalf("changed returned error: %s", err)
+	}
+	if !changed || validator.ETag != `"v2"` {
+		t.Fatalf("changed = %v, %+v, want the page changed with ETag \"v2\"", changed, validator)
+	}
+	root, err := fetchPage(context.Background(), pageUrl)
+	if err != nil {
+		t.Fatalf("fetchPage returned error: %s", err)
+	}
+	if links := findLinks(Conference{}, pageUrl, root, usenixPaperMatcher); len(links) != 2 {
+		t.Errorf("found %d paper links, want 2", len(links))
+	}
+	if requests != 1 {
+		t.Errorf("the page was requested %d times, want once", requests)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// waybackApiUrl is the Wayback Machine availability API endpoint.
+var waybackApiUrl = "https://archive.org/wayback/available"
+
+// waybackSource marks index and manifest entries downloaded from a Wayback
+// Machine snapshot.
+const waybackSource = "wayback"
+
+// waybackAvailability is the part of the availability API response we use.
+type waybackAvailability struct {
+	ArchivedSnapshots struct {
+		Closest struct {
+			Available bool   `json:"available"`
+			Url       string `json:"url"`
+			Status    string `json:"status"`
+			Timestamp string `json:"timestamp"`
+		} `json:"closest"`
+	} `json:"archived_snapshots"`
+}
+
+func isWaybackUrl(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && (u.Host == "archive.org" || strings.HasSuffix(u.Host, ".archive.org"))
+}
+
+// searchWayback returns the URL of the original file of the most recent
+// successful Wayback Machine snapshot of fileUrl, or NoWaybackSnapshotErr if
+// there is none.
+func searchWayback(ctx context.Context, fileUrl string) (string, error) {
+	query := url.Values{}
+	query.Set("url", fileUrl)
+	searchUrl := waybackApiUrl + "?" + query.Encode()
+
+	resp, err := httpGet(ctx, searchUrl)
+	if err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &URLError{PageUrl: searchUrl, Err: &UnexpectedStatusError{StatusCode: resp.StatusCode, Status: resp.Status}}
+	}
+
+	body, err := decodeBody(resp)
+	if err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	var availability waybackAvailability
+	if err := json.NewDecoder(body).Decode(&availability); err != nil {
+		return "", &URLError{PageUrl: searchUrl, Err: err}
+	}
+	closest := availability.ArchivedSnapshots.Closest
+	if !closest.Available || closest.Status != "200" || closest.Timestamp == "" {
+		return "", &URLError{PageUrl: searchUrl, Err: NoWaybackSnapshotErr}
+	}
+	// the id_ flag serves the archived file as is, without the Wayback toolbar
+	return fmt.Sprintf("https://web.archive.org/web/%sid_/%s", closest.Timestamp, fileUrl), nil
+}
+
+// downloadFromWayback downloads paper from the latest Wayback Machine snapshot
+// of its download URL instead, if -wayback-fallback is set, recording it in b.
+// filename is the file name given to the dead link. It reports whether the
+// snapshot was downloaded.
+func (r *conferenceRun) downloadFromWayback(ctx context.Context, paper Paper, filename string, b *batch) bool {
+	if !config.waybackFallback || isWaybackUrl(paper.DownloadURL) || ctx.Err() != nil {
+		return false
+	}
+	snapshotUrl, err := searchWayback(ctx, paper.DownloadURL)
+	if err != nil {
+		logger.warnf("no Wayback Machine fallback for %s: %s", paper.DownloadURL, err)
+		return false
+	}
+	logger.infof("falling back to the Wayback Machine for %s: %s", paper.DownloadURL, snapshotUrl)
+	// the snapshot keeps the file name given to the dead link
+	r.mu.Lock()
+	delete(r.filenameUrls, filename)
+	r.mu.Unlock()
+	paper.DownloadURL = snapshotUrl
+	return r.downloadPaperFrom(ctx, paper, waybackSource, b)
+}